@@ -0,0 +1,417 @@
+package controllers
+
+import (
+	"ass3_part2/logging"
+	"ass3_part2/middleware"
+	"ass3_part2/models"
+	"ass3_part2/repository"
+	"context"
+	"encoding/json"
+	"errors"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const minPasswordLength = 8
+
+// dummyPasswordHash используется при входе с несуществующим email,
+// чтобы время ответа не выдавало наличие пользователя.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+
+type RegisterRequest struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	TOTPCode string `json:"totp_code,omitempty"` // необязателен: сразу подтверждает второй фактор
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func truncate(value string, max int) string {
+	if len(value) > max {
+		return value[:max]
+	}
+	return value
+}
+
+// AuthController отвечает за регистрацию, вход, сессии, подтверждение email,
+// смену пароля и второй фактор.
+type AuthController struct {
+	Users          repository.UserRepository
+	Sessions       repository.SessionRepository
+	RefreshTokens  repository.RefreshTokenRepository
+	PasswordResets repository.PasswordResetRepository
+	SecondFactors  repository.SecondFactorRepository
+	Tx             repository.Transactor
+	SecondFactor   *middleware.SecondFactorVerifier
+}
+
+func NewAuthController(repos repository.Repositories, secondFactor *middleware.SecondFactorVerifier) *AuthController {
+	return &AuthController{
+		Users:          repos.Users,
+		Sessions:       repos.Sessions,
+		RefreshTokens:  repos.RefreshTokens,
+		PasswordResets: repos.PasswordResets,
+		SecondFactors:  repos.SecondFactors,
+		Tx:             repos.Tx,
+		SecondFactor:   secondFactor,
+	}
+}
+
+// issueTokens создает новый refresh-токен в сессии и выпускает к нему access-токен.
+func (c *AuthController) issueTokens(ctx context.Context, user models.User, session models.Session) (TokenResponse, error) {
+	refreshToken, err := middleware.GenerateRandomToken(32)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	record := models.RefreshToken{
+		SessionID: session.ID,
+		UserID:    user.ID,
+		TokenHash: middleware.HashToken(refreshToken),
+		ExpiresAt: time.Now().Add(middleware.RefreshTokenTTL),
+	}
+	if err := c.RefreshTokens.Create(ctx, &record); err != nil {
+		return TokenResponse{}, err
+	}
+
+	accessToken, expiresAt, err := middleware.GenerateAccessToken(user, session)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	return TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(time.Until(expiresAt).Seconds()),
+	}, nil
+}
+
+// revokeSession отзывает сессию, после чего ни один ее refresh-токен не примет /auth/refresh.
+func (c *AuthController) revokeSession(ctx context.Context, sessionID string) error {
+	if err := c.Sessions.Revoke(ctx, sessionID); err != nil {
+		return err
+	}
+	middleware.Revocations.ForgetSession(sessionID)
+	return nil
+}
+
+// revokeUserSessions отзывает все сессии пользователя, кроме exceptSessionID (если он задан).
+func (c *AuthController) revokeUserSessions(ctx context.Context, userID int64, exceptSessionID string) error {
+	sessionIDs, err := c.Sessions.RevokeByUser(ctx, userID, exceptSessionID)
+	if err != nil {
+		return err
+	}
+	for _, sessionID := range sessionIDs {
+		middleware.Revocations.ForgetSession(sessionID)
+	}
+	return nil
+}
+
+// currentUser загружает пользователя, которому принадлежит access-токен запроса.
+func (c *AuthController) currentUser(r *http.Request) (models.User, *middleware.Claims, error) {
+	claims, ok := middleware.ClaimsFromContext(r.Context())
+	if !ok {
+		return models.User{}, nil, errors.New("request is not authenticated")
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		return models.User{}, nil, err
+	}
+	user, err := c.Users.Get(r.Context(), userID)
+	if err != nil {
+		return user, nil, err
+	}
+	return user, claims, nil
+}
+
+// Register создает пользователя с bcrypt-хешем пароля.
+func (c *AuthController) Register(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var req RegisterRequest
+	if err := decodeJSON(r, &req); err != nil {
+		logging.FromContext(r.Context()).Error("Invalid JSON", zap.Error(err))
+		writeDecodeError(w, err)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	req.Email = normalizeEmail(req.Email)
+	if req.Name == "" || !strings.Contains(req.Email, "@") {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Name and a valid email are required"})
+		return
+	}
+	if len(req.Password) < minPasswordLength {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Password must be at least 8 characters long"})
+		return
+	}
+
+	_, err := c.Users.GetByEmail(r.Context(), req.Email)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		logging.FromContext(r.Context()).Error("Failed to check email", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to register user"})
+		return
+	}
+	if err == nil {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Email is already registered"})
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to hash password", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to register user"})
+		return
+	}
+
+	user := models.User{
+		Name:     req.Name,
+		Email:    req.Email,
+		Password: string(hash),
+	}
+	// Роль "user" заводится миграцией 0007; без нее users.role_id нарушил бы внешний ключ.
+	role, err := c.Users.RoleByCode(r.Context(), "user")
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to load default role", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to register user"})
+		return
+	}
+	user.RoleID = role.ID
+
+	if err := c.Users.Create(r.Context(), &user); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to create user", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to register user"})
+		return
+	}
+
+	// Ошибка отправки письма не отменяет регистрацию: ссылку можно запросить повторно.
+	if err := c.sendConfirmation(r.Context(), &user, 0); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to send confirmation email", zap.Error(err))
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(Response{Status: "success", Message: "User registered successfully, please confirm your email", Data: user})
+}
+
+// Login проверяет email и пароль, открывает новую сессию и выдает пару токенов.
+func (c *AuthController) Login(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var req LoginRequest
+	if err := decodeJSON(r, &req); err != nil {
+		logging.FromContext(r.Context()).Error("Invalid JSON", zap.Error(err))
+		writeDecodeError(w, err)
+		return
+	}
+
+	user, err := c.Users.GetByEmail(r.Context(), normalizeEmail(req.Email))
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		logging.FromContext(r.Context()).Error("Failed to load user", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to log in"})
+		return
+	}
+	if err != nil {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(req.Password))
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Invalid email or password"})
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)) != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Invalid email or password"})
+		return
+	}
+
+	amr := "pwd"
+	if req.TOTPCode != "" {
+		valid, err := c.SecondFactor.Verify(r.Context(), user.ID, req.TOTPCode)
+		if err != nil && !errors.Is(err, middleware.ErrTOTPNotEnabled) {
+			logging.FromContext(r.Context()).Error("Failed to verify second factor", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to log in"})
+			return
+		}
+		if !valid {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Invalid two-factor code"})
+			return
+		}
+		amr = "pwd,otp"
+	}
+
+	sessionID, err := middleware.GenerateRandomToken(16)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to generate session ID", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to log in"})
+		return
+	}
+
+	var tokens TokenResponse
+	err = c.Tx.InTx(r.Context(), func(ctx context.Context) error {
+		session := models.Session{
+			ID:         sessionID,
+			UserID:     user.ID,
+			UserAgent:  truncate(r.UserAgent(), 255),
+			IP:         middleware.ClientIP(r),
+			LastSeenAt: time.Now(),
+			AuthTime:   time.Now(),
+			AMR:        amr,
+			ExpiresAt:  time.Now().Add(middleware.RefreshTokenTTL),
+		}
+		if err := c.Sessions.Create(ctx, &session); err != nil {
+			return err
+		}
+		var err error
+		tokens, err = c.issueTokens(ctx, user, session)
+		return err
+	})
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to issue tokens", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to log in"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(Response{Status: "success", Message: "Logged in successfully", Data: tokens})
+}
+
+// errRefreshTokenInvalid возвращается из транзакции ротации, когда токен нельзя обменять.
+var errRefreshTokenInvalid = errors.New("refresh token is invalid")
+
+// Refresh обменивает refresh-токен на новую пару токенов (ротация).
+// Повторное использование уже обмененного токена отзывает всю сессию.
+func (c *AuthController) Refresh(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var req RefreshRequest
+	if err := decodeJSON(r, &req); err != nil || req.RefreshToken == "" {
+		writeDecodeError(w, err)
+		return
+	}
+
+	var tokens TokenResponse
+	reused := false
+	err := c.Tx.InTx(r.Context(), func(ctx context.Context) error {
+		token, err := c.RefreshTokens.GetByHash(ctx, middleware.HashToken(req.RefreshToken))
+		if errors.Is(err, repository.ErrNotFound) {
+			return errRefreshTokenInvalid
+		}
+		if err != nil {
+			return err
+		}
+
+		session, err := c.Sessions.Get(ctx, token.SessionID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return errRefreshTokenInvalid
+		}
+		if err != nil {
+			return err
+		}
+		if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+			return errRefreshTokenInvalid
+		}
+
+		if token.UsedAt != nil {
+			reused = true
+			return c.revokeSession(ctx, session.ID)
+		}
+		if time.Now().After(token.ExpiresAt) {
+			return errRefreshTokenInvalid
+		}
+
+		if err := c.RefreshTokens.MarkUsed(ctx, token.ID); err != nil {
+			return err
+		}
+		if err := c.Sessions.UpdateFields(ctx, session.ID, map[string]interface{}{
+			"last_seen_at": time.Now(),
+			"ip":           middleware.ClientIP(r),
+		}); err != nil {
+			return err
+		}
+
+		user, err := c.Users.Get(ctx, token.UserID)
+		if err != nil {
+			return err
+		}
+		tokens, err = c.issueTokens(ctx, user, session)
+		return err
+	})
+
+	if reused {
+		logging.FromContext(r.Context()).Warn("Refresh token reuse detected, session revoked")
+	}
+	if reused || errors.Is(err, errRefreshTokenInvalid) {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Invalid refresh token"})
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to refresh tokens", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to refresh tokens"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(Response{Status: "success", Message: "Tokens refreshed successfully", Data: tokens})
+}
+
+// Logout отзывает сессию, к которой относится переданный refresh-токен.
+func (c *AuthController) Logout(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var req RefreshRequest
+	if err := decodeJSON(r, &req); err != nil || req.RefreshToken == "" {
+		writeDecodeError(w, err)
+		return
+	}
+
+	token, err := c.RefreshTokens.GetByHash(r.Context(), middleware.HashToken(req.RefreshToken))
+	if err == nil {
+		err = c.revokeSession(r.Context(), token.SessionID)
+	}
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		logging.FromContext(r.Context()).Error("Failed to revoke session", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to log out"})
+		return
+	}
+
+	// Access-токен из заголовка (если он передан) отзывается сразу, не дожидаясь истечения срока.
+	if authHeader := r.Header.Get("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
+		claims, err := middleware.ParseToken(strings.TrimPrefix(authHeader, "Bearer "))
+		if err == nil && claims.ID != "" && claims.ExpiresAt != nil {
+			if err := middleware.Revocations.RevokeToken(r.Context(), claims.ID, claims.ExpiresAt.Time); err != nil {
+				logging.FromContext(r.Context()).Error("Failed to revoke access token", zap.Error(err))
+			}
+		}
+	}
+
+	// Неизвестный токен не считается ошибкой: повторный выход должен быть идемпотентным.
+	json.NewEncoder(w).Encode(Response{Status: "success", Message: "Logged out successfully"})
+}
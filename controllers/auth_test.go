@@ -0,0 +1,332 @@
+package controllers
+
+import (
+	db "ass3_part2/db/migrations"
+	"ass3_part2/encryption"
+	"ass3_part2/logging"
+	"ass3_part2/middleware"
+	"ass3_part2/models"
+	"ass3_part2/repository"
+	"ass3_part2/totp"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go.uber.org/zap"
+)
+
+// authTest - контроллер поверх репозиториев в памяти и перехваченные письма.
+type authTest struct {
+	t      *testing.T
+	repos  repository.Repositories
+	auth   *AuthController
+	emails chan models.Email
+}
+
+func newAuthTest(t *testing.T) *authTest {
+	t.Helper()
+	return newAuthTestWith(t, repository.NewMemoryRepositories(models.Role{ID: 1, Name: "User", Code: "user"}))
+}
+
+// newSQLiteAuthTest работает с настоящей базой SQLite в памяти, созданной
+// миграциями, чтобы проверить внешние ключи и шифрование полей.
+func newSQLiteAuthTest(t *testing.T) *authTest {
+	t.Helper()
+	keyring, err := encryption.NewKeyring(map[string][]byte{"k1": bytes.Repeat([]byte{3}, 32)}, "k1", bytes.Repeat([]byte{5}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryption.Default = keyring
+	t.Cleanup(func() { encryption.Default = nil })
+
+	config := db.DbConfig{Driver: db.DriverSQLite, SQLitePath: ":memory:", Pool: db.DefaultPoolConfig()}
+	if err := db.NewDb(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.CloseDb)
+	if _, err := db.MigrateUp(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return newAuthTestWith(t, repository.NewGormRepositories(db.DB))
+}
+
+func newAuthTestWith(t *testing.T, repos repository.Repositories) *authTest {
+	t.Helper()
+	logging.Logger = zap.NewNop()
+	totp.EncryptionKey = bytes.Repeat([]byte{7}, 32)
+	middleware.JwtKey = bytes.Repeat([]byte{9}, 32)
+
+	emails := make(chan models.Email, 10)
+	emailService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg models.Email
+		if err := json.Unmarshal([]byte(r.FormValue("json")), &msg); err != nil {
+			t.Errorf("email service: %v", err)
+		}
+		emails <- msg
+	}))
+	t.Cleanup(emailService.Close)
+	t.Setenv("EMAIL_SERVICE_URL", emailService.URL)
+
+	middleware.Revocations = middleware.NewRevocationStore(repos)
+	return &authTest{
+		t:      t,
+		repos:  repos,
+		auth:   NewAuthController(repos, middleware.NewSecondFactorVerifier(repos)),
+		emails: emails,
+	}
+}
+
+// call выполняет обработчик и разбирает ответ; data заполняется из поля Data.
+func (a *authTest) call(handler http.Handler, accessToken string, body interface{}, data interface{}) int {
+	a.t.Helper()
+	payload, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(payload))
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if data != nil && rec.Code < 300 {
+		response := struct{ Data json.RawMessage }{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			a.t.Fatalf("decode response %q: %v", rec.Body.String(), err)
+		}
+		if err := json.Unmarshal(response.Data, data); err != nil {
+			a.t.Fatalf("decode data %q: %v", response.Data, err)
+		}
+	}
+	return rec.Code
+}
+
+// email ждет письмо и возвращает значение параметра token из ссылки в нем.
+func (a *authTest) emailToken() string {
+	a.t.Helper()
+	select {
+	case msg := <-a.emails:
+		for _, field := range strings.Fields(msg.Body) {
+			if link, err := url.Parse(field); err == nil && link.Query().Get("token") != "" {
+				return link.Query().Get("token")
+			}
+		}
+		a.t.Fatalf("no token link in email %q", msg.Body)
+	case <-time.After(5 * time.Second):
+		a.t.Fatal("email was not sent")
+	}
+	return ""
+}
+
+func (a *authTest) register(email, password string) {
+	a.t.Helper()
+	code := a.call(http.HandlerFunc(a.auth.Register), "", RegisterRequest{Name: "Alice", Email: email, Password: password}, nil)
+	if code != http.StatusCreated {
+		a.t.Fatalf("register: status %d", code)
+	}
+	a.emailToken() // письмо подтверждения
+}
+
+func (a *authTest) login(email, password string) TokenResponse {
+	a.t.Helper()
+	var tokens TokenResponse
+	if code := a.call(http.HandlerFunc(a.auth.Login), "", LoginRequest{Email: email, Password: password}, &tokens); code != http.StatusOK {
+		a.t.Fatalf("login: status %d", code)
+	}
+	return tokens
+}
+
+func TestRefreshRotationRevokesSessionOnReuse(t *testing.T) {
+	a := newAuthTest(t)
+	a.register("alice@example.com", "password-1")
+	first := a.login(" Alice@Example.com ", "password-1")
+
+	var second TokenResponse
+	if code := a.call(http.HandlerFunc(a.auth.Refresh), "", RefreshRequest{RefreshToken: first.RefreshToken}, &second); code != http.StatusOK {
+		t.Fatalf("refresh: status %d", code)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatal("refresh token was not rotated")
+	}
+
+	// Повторное предъявление обмененного токена отзывает всю сессию.
+	if code := a.call(http.HandlerFunc(a.auth.Refresh), "", RefreshRequest{RefreshToken: first.RefreshToken}, nil); code != http.StatusUnauthorized {
+		t.Fatalf("reused refresh: status %d, want 401", code)
+	}
+	if code := a.call(http.HandlerFunc(a.auth.Refresh), "", RefreshRequest{RefreshToken: second.RefreshToken}, nil); code != http.StatusUnauthorized {
+		t.Fatalf("refresh in revoked session: status %d, want 401", code)
+	}
+	listSessions := middleware.MiddlewareAuth(http.HandlerFunc(a.auth.ListSessions))
+	if code := a.call(listSessions, second.AccessToken, nil, nil); code != http.StatusUnauthorized {
+		t.Fatalf("access token of revoked session: status %d, want 401", code)
+	}
+}
+
+func TestLogoutRevokesAccessToken(t *testing.T) {
+	a := newAuthTest(t)
+	a.register("bob@example.com", "password-1")
+	tokens := a.login("bob@example.com", "password-1")
+
+	listSessions := middleware.MiddlewareAuth(http.HandlerFunc(a.auth.ListSessions))
+	var sessions []SessionView
+	if code := a.call(listSessions, tokens.AccessToken, nil, &sessions); code != http.StatusOK {
+		t.Fatalf("list sessions: status %d", code)
+	}
+	if len(sessions) != 1 || !sessions[0].Current {
+		t.Fatalf("sessions = %+v, want one current session", sessions)
+	}
+
+	if code := a.call(http.HandlerFunc(a.auth.Logout), tokens.AccessToken, RefreshRequest{RefreshToken: tokens.RefreshToken}, nil); code != http.StatusOK {
+		t.Fatalf("logout: status %d", code)
+	}
+	if code := a.call(listSessions, tokens.AccessToken, nil, nil); code != http.StatusUnauthorized {
+		t.Fatalf("access token after logout: status %d, want 401", code)
+	}
+}
+
+func TestPasswordResetRevokesSessions(t *testing.T) {
+	a := newAuthTest(t)
+	a.register("carol@example.com", "password-1")
+	tokens := a.login("carol@example.com", "password-1")
+
+	if code := a.call(http.HandlerFunc(a.auth.ForgotPassword), "", ForgotPasswordRequest{Email: "carol@example.com"}, nil); code != http.StatusOK {
+		t.Fatalf("forgot password: status %d", code)
+	}
+	resetToken := a.emailToken()
+
+	reset := ResetPasswordRequest{Token: resetToken, NewPassword: "password-2"}
+	if code := a.call(http.HandlerFunc(a.auth.ResetPassword), "", reset, nil); code != http.StatusOK {
+		t.Fatalf("reset password: status %d", code)
+	}
+	if code := a.call(http.HandlerFunc(a.auth.ResetPassword), "", reset, nil); code != http.StatusBadRequest {
+		t.Fatalf("reused reset token: status %d, want 400", code)
+	}
+
+	if code := a.call(http.HandlerFunc(a.auth.Refresh), "", RefreshRequest{RefreshToken: tokens.RefreshToken}, nil); code != http.StatusUnauthorized {
+		t.Fatalf("refresh after reset: status %d, want 401", code)
+	}
+	if code := a.call(http.HandlerFunc(a.auth.Login), "", LoginRequest{Email: "carol@example.com", Password: "password-1"}, nil); code != http.StatusUnauthorized {
+		t.Fatalf("login with old password: status %d, want 401", code)
+	}
+	a.login("carol@example.com", "password-2")
+}
+
+func TestTOTPRecoveryCodeIsSingleUse(t *testing.T) {
+	a := newAuthTest(t)
+	a.register("dave@example.com", "password-1")
+	tokens := a.login("dave@example.com", "password-1")
+
+	var enrollment TOTPEnrollmentResponse
+	enroll := middleware.MiddlewareAuth(http.HandlerFunc(a.auth.EnrollTOTP))
+	if code := a.call(enroll, tokens.AccessToken, nil, &enrollment); code != http.StatusOK {
+		t.Fatalf("enroll: status %d", code)
+	}
+	code, err := totp.CodeAt(enrollment.Secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var recoveryCodes []string
+	confirm := middleware.MiddlewareAuth(http.HandlerFunc(a.auth.ConfirmTOTP))
+	if status := a.call(confirm, tokens.AccessToken, TOTPCodeRequest{Code: code}, &recoveryCodes); status != http.StatusOK {
+		t.Fatalf("confirm: status %d", status)
+	}
+	if len(recoveryCodes) != recoveryCodeCount {
+		t.Fatalf("got %d recovery codes, want %d", len(recoveryCodes), recoveryCodeCount)
+	}
+
+	stepUp := middleware.MiddlewareAuth(http.HandlerFunc(a.auth.StepUp))
+	if status := a.call(stepUp, tokens.AccessToken, TOTPCodeRequest{Code: recoveryCodes[0]}, nil); status != http.StatusOK {
+		t.Fatalf("step-up with recovery code: status %d", status)
+	}
+	if status := a.call(stepUp, tokens.AccessToken, TOTPCodeRequest{Code: recoveryCodes[0]}, nil); status != http.StatusUnauthorized {
+		t.Fatalf("reused recovery code: status %d, want 401", status)
+	}
+}
+
+func TestForgotPasswordIsThrottledPerAddress(t *testing.T) {
+	a := newAuthTest(t)
+	a.register("erin@example.com", "password-1")
+
+	for i := 0; i < 3; i++ {
+		if code := a.call(http.HandlerFunc(a.auth.ForgotPassword), "", ForgotPasswordRequest{Email: "erin@example.com"}, nil); code != http.StatusOK {
+			t.Fatalf("forgot password #%d: status %d", i+1, code)
+		}
+	}
+	a.emailToken()
+	select {
+	case msg := <-a.emails:
+		t.Fatalf("second reset email sent within the interval: %q", msg.Subject)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestTokenWithoutSessionIsRejected(t *testing.T) {
+	a := newAuthTest(t)
+	claims := &middleware.Claims{
+		Email: "frank@example.com",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "1",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(middleware.JwtKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listSessions := middleware.MiddlewareAuth(http.HandlerFunc(a.auth.ListSessions))
+	if code := a.call(listSessions, token, nil, nil); code != http.StatusUnauthorized {
+		t.Fatalf("token without jti and sid: status %d, want 401", code)
+	}
+}
+
+func TestRegisterOnSQLite(t *testing.T) {
+	a := newSQLiteAuthTest(t)
+	a.register("grace@example.com", "password-1")
+
+	user, err := a.repos.Users.GetByEmail(context.Background(), "grace@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	role, err := a.repos.Users.RoleByID(context.Background(), user.RoleID)
+	if err != nil || role.Code != "user" {
+		t.Fatalf("registered user role = %+v, %v; want user", role, err)
+	}
+
+	tokens := a.login(" Grace@Example.com ", "password-1")
+	if code := a.call(http.HandlerFunc(a.auth.ForgotPassword), "", ForgotPasswordRequest{Email: "grace@example.com"}, nil); code != http.StatusOK {
+		t.Fatalf("forgot password: status %d", code)
+	}
+	reset := ResetPasswordRequest{Token: a.emailToken(), NewPassword: "password-2"}
+	if code := a.call(http.HandlerFunc(a.auth.ResetPassword), "", reset, nil); code != http.StatusOK {
+		t.Fatalf("reset password: status %d", code)
+	}
+	if code := a.call(http.HandlerFunc(a.auth.Refresh), "", RefreshRequest{RefreshToken: tokens.RefreshToken}, nil); code != http.StatusUnauthorized {
+		t.Fatalf("refresh after reset: status %d, want 401", code)
+	}
+	a.login("grace@example.com", "password-2")
+}
+
+// TestLegacyEmailLookupIsNormalized проверяет, что строка, еще не зашифрованная
+// rotate-keys (email открыт, email_index пуст), находится по адресу с пробелами
+// и в другом регистре, как и зашифрованная.
+func TestLegacyEmailLookupIsNormalized(t *testing.T) {
+	a := newSQLiteAuthTest(t)
+	err := db.DB.Exec(`INSERT INTO users (name, email, role_id, password, is_confirmed)
+		SELECT 'Legacy', 'legacy@example.com', id, 'x', true FROM roles WHERE code = 'user'`).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := a.repos.Users.GetByEmail(context.Background(), " Legacy@Example.COM ")
+	if err != nil {
+		t.Fatalf("legacy lookup: %v", err)
+	}
+	if user.Email != "legacy@example.com" {
+		t.Fatalf("legacy lookup found %q", user.Email)
+	}
+}
@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"ass3_part2/email"
+	"ass3_part2/logging"
+	"ass3_part2/middleware"
+	"ass3_part2/models"
+	"ass3_part2/repository"
+	"context"
+	"encoding/json"
+	"errors"
+	"go.uber.org/zap"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	// ConfirmationTokenTTL - срок действия ссылки подтверждения email.
+	ConfirmationTokenTTL = 24 * time.Hour
+	// ConfirmationResendInterval - минимальный интервал между повторными письмами.
+	ConfirmationResendInterval = time.Minute
+)
+
+type ResendConfirmationRequest struct {
+	Email string `json:"email"`
+}
+
+// appBaseURL возвращает публичный адрес сервиса для ссылок в письмах (APP_BASE_URL).
+func appBaseURL() string {
+	if baseURL := os.Getenv("APP_BASE_URL"); baseURL != "" {
+		return baseURL
+	}
+	return "http://localhost:8081"
+}
+
+// sendConfirmation выпускает новый токен подтверждения, сохраняет его хеш
+// и отправляет пользователю письмо со ссылкой. Если прошлое письмо ушло меньше
+// cooldown назад, возвращает repository.ErrThrottled.
+func (c *AuthController) sendConfirmation(ctx context.Context, user *models.User, cooldown time.Duration) error {
+	token, err := middleware.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+	tokenHash := middleware.HashToken(token)
+	now := time.Now()
+	if err := c.Users.SetConfirmationToken(ctx, user.ID, tokenHash, now, cooldown); err != nil {
+		return err
+	}
+	user.ConfirmationToken = &tokenHash
+	user.ConfirmationSentAt = &now
+
+	link := appBaseURL() + "/auth/confirm?token=" + url.QueryEscape(token)
+	return email.Send(ctx, models.Email{
+		To:      user.Email,
+		Subject: "Confirm your email - Example Corp",
+		Body: "Dear " + user.Name + ",\n\nPlease confirm your email address by following the link:\n" + link +
+			"\n\nThe link is valid for 24 hours.",
+	})
+}
+
+// ConfirmEmail подтверждает email по токену из письма.
+func (c *AuthController) ConfirmEmail(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Confirmation token is required"})
+		return
+	}
+
+	user, err := c.Users.GetByConfirmationToken(r.Context(), middleware.HashToken(token))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Invalid or expired confirmation token"})
+		return
+	}
+	if user.ConfirmationSentAt == nil || time.Since(*user.ConfirmationSentAt) > ConfirmationTokenTTL {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Invalid or expired confirmation token"})
+		return
+	}
+
+	if err := c.Users.UpdateFields(r.Context(), user.ID, map[string]interface{}{
+		"is_confirmed":       true,
+		"confirmation_token": nil,
+	}); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to confirm email", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to confirm email"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(Response{Status: "success", Message: "Email confirmed successfully"})
+}
+
+// ResendConfirmation повторно отправляет письмо подтверждения не чаще
+// одного раза в ConfirmationResendInterval. Как и в ForgotPassword, ответ одинаков
+// для любых адресов, в том числе при частых запросах, а письмо уходит в фоне.
+func (c *AuthController) ResendConfirmation(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var req ResendConfirmationRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	// Интервал проверяется атомарно при записи токена, поэтому одновременные
+	// запросы не отправят несколько писем.
+	user, err := c.Users.GetByEmail(r.Context(), normalizeEmail(req.Email))
+	if err == nil && !user.IsConfirmed {
+		ctx := context.WithoutCancel(r.Context())
+		go func() {
+			err := c.sendConfirmation(ctx, &user, ConfirmationResendInterval)
+			if errors.Is(err, repository.ErrThrottled) {
+				return
+			}
+			if err != nil {
+				logging.FromContext(ctx).Error("Failed to send confirmation email", zap.Error(err))
+			}
+		}()
+	}
+
+	json.NewEncoder(w).Encode(Response{
+		Status:  "success",
+		Message: "If the address is registered and not yet confirmed, a confirmation email has been sent",
+	})
+}
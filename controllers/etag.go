@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// versionETag формирует сильный ETag из версии записи.
+func versionETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// matchesETag проверяет список тегов из If-Match/If-None-Match против версии.
+func matchesETag(header string, version int64) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == versionETag(version) {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchVersion проверяет If-Match для записи с текущей версией current.
+// Возвращает версию, которую нужно ожидать при записи (0, если заголовка нет),
+// и false, если ни один тег не совпал - тогда отвечаем 412.
+func ifMatchVersion(r *http.Request, current int64) (int64, bool) {
+	header := strings.Join(r.Header.Values("If-Match"), ",")
+	if header == "" {
+		return 0, true
+	}
+	if !matchesETag(header, current) {
+		return 0, false
+	}
+	return current, true
+}
+
+// writePreconditionFailed отвечает 412, когда клиент правит устаревшую версию.
+func writePreconditionFailed(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusPreconditionFailed)
+	json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Resource was modified by another request; reload it and retry"})
+}
+
+// writePreconditionRequired отвечает 428, когда изменение пришло без ожидаемой версии.
+func writePreconditionRequired(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusPreconditionRequired)
+	json.NewEncoder(w).Encode(Response{Status: "fail", Message: "If-Match header or version field is required"})
+}
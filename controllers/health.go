@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	db "ass3_part2/db/migrations"
+	"ass3_part2/email"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// readinessTimeout ограничивает суммарное время проверок /readyz.
+const readinessTimeout = 2 * time.Second
+
+// ReadinessResponse - результат /readyz: "ok" или текст ошибки для каждой проверки.
+type ReadinessResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+var shuttingDown atomic.Bool
+
+// BeginShutdown переводит /readyz в 503, чтобы балансировщик перестал
+// направлять трафик до остановки сервера.
+func BeginShutdown() {
+	shuttingDown.Store(true)
+}
+
+// checkEmailService включает проверку микросервиса email (READINESS_CHECK_EMAIL).
+func checkEmailService() bool {
+	check, _ := strconv.ParseBool(os.Getenv("READINESS_CHECK_EMAIL"))
+	return check
+}
+
+// Healthz отвечает 200, пока процесс жив; зависимости не проверяются.
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Response{Status: "success", Message: "ok"})
+}
+
+// Readyz проверяет доступность базы, примененную миграцию и, если включено,
+// микросервис email. Во время остановки сервера всегда отвечает 503.
+func Readyz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if shuttingDown.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(ReadinessResponse{Status: "fail", Checks: map[string]string{"server": "shutting down"}})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	checks := map[string]func(context.Context) error{
+		"database": db.Ping,
+		"schema":   db.CheckSchema,
+	}
+	if checkEmailService() {
+		checks["email"] = email.Ping
+	}
+
+	response := ReadinessResponse{Status: "success", Checks: make(map[string]string, len(checks))}
+	for name, check := range checks {
+		if err := check(ctx); err != nil {
+			response.Status = "fail"
+			response.Checks[name] = err.Error()
+			continue
+		}
+		response.Checks[name] = "ok"
+	}
+
+	if response.Status != "success" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(response)
+}
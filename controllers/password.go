@@ -0,0 +1,213 @@
+package controllers
+
+import (
+	"ass3_part2/email"
+	"ass3_part2/logging"
+	"ass3_part2/middleware"
+	"ass3_part2/models"
+	"ass3_part2/repository"
+	"context"
+	"encoding/json"
+	"errors"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	// PasswordResetTokenTTL - срок действия ссылки сброса пароля.
+	PasswordResetTokenTTL = time.Hour
+	// PasswordResetInterval - минимальный интервал между письмами сброса на один адрес.
+	PasswordResetInterval = 5 * time.Minute
+)
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+var errResetTokenInvalid = errors.New("password reset token is invalid")
+
+// passwordResetURL возвращает адрес страницы сброса пароля (PASSWORD_RESET_URL).
+func passwordResetURL() string {
+	if resetURL := os.Getenv("PASSWORD_RESET_URL"); resetURL != "" {
+		return resetURL
+	}
+	return appBaseURL() + "/reset-password"
+}
+
+// sendPasswordReset погашает прежние неиспользованные токены пользователя,
+// выпускает новый и отправляет ссылку на email. Если предыдущий токен выпущен
+// меньше PasswordResetInterval назад, возвращает repository.ErrThrottled.
+func (c *AuthController) sendPasswordReset(ctx context.Context, user models.User) error {
+	token, err := middleware.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	err = c.PasswordResets.Create(ctx, &models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: middleware.HashToken(token),
+		ExpiresAt: time.Now().Add(PasswordResetTokenTTL),
+	}, PasswordResetInterval)
+	if err != nil {
+		return err
+	}
+
+	link := passwordResetURL() + "?token=" + url.QueryEscape(token)
+	return email.Send(ctx, models.Email{
+		To:      user.Email,
+		Subject: "Password reset - Example Corp",
+		Body: "Dear " + user.Name + ",\n\nTo reset your password follow the link:\n" + link +
+			"\n\nThe link is valid for 1 hour. If you did not request a password reset, ignore this email.",
+	})
+}
+
+// ForgotPassword отправляет ссылку для сброса пароля. Ответ одинаков для
+// существующих и несуществующих адресов, а письмо отправляется в фоне,
+// чтобы ни содержимое, ни время ответа не позволяли перебирать пользователей.
+// На один адрес уходит не больше одного письма за PasswordResetInterval.
+func (c *AuthController) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var req ForgotPasswordRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	if user, err := c.Users.GetByEmail(r.Context(), normalizeEmail(req.Email)); err == nil {
+		ctx := context.WithoutCancel(r.Context())
+		go func() {
+			err := c.sendPasswordReset(ctx, user)
+			if errors.Is(err, repository.ErrThrottled) {
+				logging.FromContext(ctx).Info("Password reset email throttled", zap.Int64("user_id", user.ID))
+				return
+			}
+			if err != nil {
+				logging.FromContext(ctx).Error("Failed to send password reset email", zap.Error(err))
+			}
+		}()
+	}
+
+	json.NewEncoder(w).Encode(Response{Status: "success", Message: "If the address is registered, a password reset email has been sent"})
+}
+
+// ResetPassword устанавливает новый пароль по одноразовому токену и отзывает все сессии пользователя.
+func (c *AuthController) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var req ResetPasswordRequest
+	if err := decodeJSON(r, &req); err != nil || req.Token == "" {
+		writeDecodeError(w, err)
+		return
+	}
+	if len(req.NewPassword) < minPasswordLength {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Password must be at least 8 characters long"})
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to hash password", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to reset password"})
+		return
+	}
+
+	err = c.Tx.InTx(r.Context(), func(ctx context.Context) error {
+		token, err := c.PasswordResets.GetByHash(ctx, middleware.HashToken(req.Token))
+		if errors.Is(err, repository.ErrNotFound) {
+			return errResetTokenInvalid
+		}
+		if err != nil {
+			return err
+		}
+		if token.UsedAt != nil || time.Now().After(token.ExpiresAt) {
+			return errResetTokenInvalid
+		}
+
+		if err := c.PasswordResets.MarkUsed(ctx, token.ID); err != nil {
+			return err
+		}
+		if err := c.Users.UpdateFields(ctx, token.UserID, map[string]interface{}{"password": string(hash)}); err != nil {
+			return err
+		}
+		return c.revokeUserSessions(ctx, token.UserID, "")
+	})
+	if errors.Is(err, errResetTokenInvalid) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Invalid or expired password reset token"})
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to reset password", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to reset password"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(Response{Status: "success", Message: "Password has been reset successfully"})
+}
+
+// ChangePassword меняет пароль аутентифицированного пользователя после проверки
+// текущего пароля и отзывает все его сессии, кроме текущей.
+func (c *AuthController) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	user, claims, err := c.currentUser(r)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Unauthorized"})
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)) != nil {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Current password is incorrect"})
+		return
+	}
+	if len(req.NewPassword) < minPasswordLength {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Password must be at least 8 characters long"})
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to hash password", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to change password"})
+		return
+	}
+
+	err = c.Tx.InTx(r.Context(), func(ctx context.Context) error {
+		if err := c.Users.UpdateFields(ctx, user.ID, map[string]interface{}{"password": string(hash)}); err != nil {
+			return err
+		}
+		return c.revokeUserSessions(ctx, user.ID, claims.SessionID)
+	})
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to change password", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to change password"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(Response{Status: "success", Message: "Password changed successfully"})
+}
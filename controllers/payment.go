@@ -1,21 +1,33 @@
 package controllers
 
 import (
-	"ass3_part2/db/migrations" // импорт вашего пакета для работы с БД
+	"ass3_part2/email"
+	"ass3_part2/logging"
+	"ass3_part2/metrics"
 	"ass3_part2/models"
+	"ass3_part2/money"
+	"ass3_part2/repository"
+	"ass3_part2/tracing"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"mime/multipart"
+	"go.uber.org/zap"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
-	"io"
-    "log"
 
 	"github.com/jung-kurt/gofpdf"
 )
 
+// paymentProvider - платежный провайдер в метриках; пока оплата возможна только картой.
+const paymentProvider = "card"
+
+// errPlanArchived означает попытку купить архивный тариф.
+var errPlanArchived = errors.New("subscription plan is archived")
+
 // Payment описывает входные данные платежа.
 type Payment struct {
 	UserID         uint        `json:"user_id"`
@@ -30,6 +42,31 @@ type PaymentForm struct {
 	CVV            string `json:"cvv"`
 }
 
+// PaymentController оформляет оплату подписок.
+type PaymentController struct {
+	Users             repository.UserRepository
+	Plans             repository.PlanRepository
+	UserSubscriptions repository.UserSubscriptionRepository
+	Transactions      repository.TransactionRepository
+	Tx                repository.Transactor
+}
+
+func NewPaymentController(repos repository.Repositories) *PaymentController {
+	return &PaymentController{
+		Users:             repos.Users,
+		Plans:             repos.Plans,
+		UserSubscriptions: repos.UserSubscriptions,
+		Transactions:      repos.Transactions,
+		Tx:                repos.Tx,
+	}
+}
+
+// requireEmailConfirmation сообщает, нужно ли запрещать оплату пользователям
+// с неподтвержденным email (переменная окружения REQUIRE_EMAIL_CONFIRMATION).
+func requireEmailConfirmation() bool {
+	return os.Getenv("REQUIRE_EMAIL_CONFIRMATION") == "true"
+}
+
 // maskCard возвращает номер карты с замаскированными первыми цифрами (оставляет видимыми только последние 4 цифры).
 func maskCard(cardNumber string) string {
 	if len(cardNumber) < 4 {
@@ -39,8 +76,16 @@ func maskCard(cardNumber string) string {
 }
 
 // generateFiscalReceiptPDF генерирует PDF-файл с фискальным чеком на английском языке.
-func generateFiscalReceiptPDF(companyName string, transactionNumber uint, orderDate time.Time,
-	itemName string, unitPrice float64, quantity int, clientName string, encryptedCard string) ([]byte, error) {
+func generateFiscalReceiptPDF(ctx context.Context, companyName string, transactionNumber uint, orderDate time.Time,
+	itemName string, unitPrice money.Money, quantity int64, clientName string, encryptedCard string) ([]byte, error) {
+	_, span := tracing.Tracer.Start(ctx, "generateFiscalReceiptPDF")
+	defer span.End()
+
+	total, err := unitPrice.Mul(quantity)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
 
 	pdf := gofpdf.New("P", "mm", "A4", "")
 	pdf.AddPage()
@@ -55,20 +100,19 @@ func generateFiscalReceiptPDF(companyName string, transactionNumber uint, orderD
 	pdf.Cell(40, 10, fmt.Sprintf("Transaction Number: %d", transactionNumber))
 	pdf.Ln(10)
 
-	pdf.Cell(40, 10, fmt.Sprintf("Order Date and Time: %s", orderDate.Format("2006-01-02 15:04:05")))
+	pdf.Cell(40, 10, fmt.Sprintf("Order Date and Time: %s", orderDate.UTC().Format("2006-01-02 15:04:05 MST")))
 	pdf.Ln(10)
 
 	pdf.Cell(40, 10, fmt.Sprintf("Item/Service: %s", itemName))
 	pdf.Ln(10)
 
-	pdf.Cell(40, 10, fmt.Sprintf("Unit Price: %.2f", unitPrice))
+	pdf.Cell(40, 10, fmt.Sprintf("Unit Price: %s", unitPrice))
 	pdf.Ln(10)
 
 	pdf.Cell(40, 10, fmt.Sprintf("Quantity: %d", quantity))
 	pdf.Ln(10)
 
-	total := unitPrice * float64(quantity)
-	pdf.Cell(40, 10, fmt.Sprintf("Total Amount: %.2f", total))
+	pdf.Cell(40, 10, fmt.Sprintf("Total Amount: %s", total))
 	pdf.Ln(10)
 
 	pdf.Cell(40, 10, fmt.Sprintf("Client Name: %s", clientName))
@@ -79,6 +123,7 @@ func generateFiscalReceiptPDF(companyName string, transactionNumber uint, orderD
 
 	var buf bytes.Buffer
 	if err := pdf.Output(&buf); err != nil {
+		span.RecordError(err)
 		return nil, err
 	}
 	return buf.Bytes(), nil
@@ -92,22 +137,26 @@ func generateFiscalReceiptPDF(companyName string, transactionNumber uint, orderD
 //   - Чек отправляется на электронную почту клиента через микросервис.
 //   - Статус транзакции обновляется до "completed".
 //   - Возвращается JSON с информацией о платеже.
-func PaySubscription(w http.ResponseWriter, r *http.Request) {
+func (c *PaymentController) PaySubscription(w http.ResponseWriter, r *http.Request) {
 	// Для формирования JSON-ответов устанавливаем Content-Type.
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	// Исход платежа для метрики; все неописанные ниже выходы считаются ошибками сервиса.
+	outcome := "error"
+	defer func() {
+		metrics.Payments.WithLabelValues(outcome, paymentProvider).Inc()
+	}()
 
 	var payment Payment
-	if err := json.NewDecoder(r.Body).Decode(&payment); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Invalid JSON"})
+	if err := decodeJSON(r, &payment); err != nil {
+		outcome = "invalid"
+		writeDecodeError(w, err)
 		return
 	}
 
 	// Проверка обязательных платежных данных.
 	if payment.PaymentForm.CardNumber == "" || payment.PaymentForm.ExpirationDate == "" || payment.PaymentForm.CVV == "" {
+		outcome = "invalid"
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Invalid payment details"})
 		return
@@ -117,62 +166,106 @@ func PaySubscription(w http.ResponseWriter, r *http.Request) {
 	// Предполагается, что срок действия передаётся в формате "01/2006" (месяц/год).
 	expirationTime, err := time.Parse("01/2006", payment.PaymentForm.ExpirationDate)
 	if err != nil {
+		outcome = "invalid"
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Invalid expiration date format"})
 		return
 	}
-	if expirationTime.Before(time.Now()) {
+	// Карта действует до конца указанного месяца включительно (по UTC).
+	if !time.Now().UTC().Before(expirationTime.AddDate(0, 1, 0)) {
 		// Если карта просрочена – имитируем отказ в оплате.
+		outcome = "declined"
 		w.WriteHeader(http.StatusPaymentRequired) // Код 402 Payment Required
 		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Payment rejected: Card expired"})
 		return
 	}
 
-	// Рассчитываем период подписки.
-	var subscription models.PremiumSubscription
-	// Находим подписку по payment.SubscriptionID (предполагается, что модель содержит поля Period и Price).
-	db.DB.First(&subscription, payment.SubscriptionID)
-
-	startDate := time.Now()
-	endDate := startDate.Add(time.Hour * 24 * time.Duration(subscription.Period)) // subscription.Period – количество дней
-
-	// Создание записи о подписке пользователя.
-	userSubscription := models.UserSubscription{
-		UserID:         payment.UserID,
-		SubscriptionID: payment.SubscriptionID,
-		StartDate:      startDate.Format(time.RFC3339),
-		EndDate:        endDate.Format(time.RFC3339),
-		CreatedAt:      time.Now().Format(time.RFC3339),
-		UpdatedAt:      time.Now().Format(time.RFC3339),
+	// Получаем данные пользователя для отправки email (например, email и имя).
+	user, err := c.Users.Get(r.Context(), int64(payment.UserID))
+	if err != nil {
+		outcome = "invalid"
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "User not found"})
+		return
 	}
-	db.DB.Create(&userSubscription)
-
-	// Создание записи транзакции с первоначальным статусом "paid".
-	transaction := models.Transaction{
-		SubscriptionID: payment.SubscriptionID,
-		Status:         "paid",
-		CreatedAt:      time.Now().Format(time.RFC3339),
-		UpdatedAt:      time.Now().Format(time.RFC3339),
+	// Чек уходит на email пользователя, поэтому при включенной проверке
+	// неподтвержденные адреса не могут оплачивать подписку.
+	if requireEmailConfirmation() && !user.IsConfirmed {
+		outcome = "rejected"
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Email address is not confirmed"})
+		return
 	}
-	db.DB.Create(&transaction)
 
-	// Получаем данные пользователя для отправки email (например, email и имя).
-	var user models.User
-	if err := db.DB.First(&user, payment.UserID).Error; err != nil {
+	// Тариф читается и проверяется внутри транзакции SERIALIZABLE вместе с
+	// записью подписки и транзакции: если тариф изменят или заархивируют
+	// одновременно с оплатой, транзакция повторится и прочитает его заново.
+	var subscription models.PremiumSubscription
+	var userSubscription models.UserSubscription
+	var transaction models.Transaction
+	var startDate time.Time
+	err = c.Tx.InSerializableTx(r.Context(), func(ctx context.Context) error {
+		var err error
+		if subscription, err = c.Plans.Get(ctx, payment.SubscriptionID); err != nil {
+			return err
+		}
+		// Архивный тариф нельзя купить, хотя оформленные подписки по нему действуют.
+		if subscription.Status == models.PlanStatusArchived {
+			return errPlanArchived
+		}
+
+		// Даты хранятся в UTC; период прибавляется календарными днями.
+		startDate = time.Now().UTC()
+		userSubscription = models.UserSubscription{
+			UserID:         payment.UserID,
+			SubscriptionID: payment.SubscriptionID,
+			StartDate:      startDate,
+			EndDate:        startDate.AddDate(0, 0, int(subscription.Period)), // subscription.Period – количество дней
+		}
+		if err := c.UserSubscriptions.Create(ctx, &userSubscription); err != nil {
+			return fmt.Errorf("create user subscription: %w", err)
+		}
+
+		// Создание записи транзакции с первоначальным статусом "paid" на сумму тарифа.
+		transaction = models.Transaction{
+			SubscriptionID: payment.SubscriptionID,
+			Amount:         subscription.Price,
+			Status:         "paid",
+		}
+		if err := c.Transactions.Create(ctx, &transaction); err != nil {
+			return fmt.Errorf("create transaction: %w", err)
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		outcome = "invalid"
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Subscription not found"})
+		return
+	case errors.Is(err, errPlanArchived):
+		outcome = "rejected"
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Subscription plan is archived"})
+		return
+	case err != nil:
+		logging.FromContext(r.Context()).Error("Failed to record payment", zap.Error(err))
 		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "User not found"})
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to process payment"})
 		return
 	}
+
 	// Используем имя пользователя из БД.
 	clientName := user.Name
 
 	// Генерация PDF‑чека (на английском языке).
 	pdfBytes, err := generateFiscalReceiptPDF(
+		r.Context(),
 		"Example Corp",                           // Company/Project name
 		transaction.ID,                           // Transaction Number
-		time.Now(),                               // Order Date and Time
+		startDate,                                // Order Date and Time
 		"Premium Subscription",                   // Item/Service
-		100,                                      // Unit Price (предполагается, что это поле есть в модели подписки)
+		subscription.Price,                       // Unit Price
 		1,                                        // Quantity
 		clientName,                               // Client Name
 		maskCard(payment.PaymentForm.CardNumber), // Payment Method (masked card number)
@@ -184,99 +277,32 @@ func PaySubscription(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Отправка PDF‑чека на электронную почту клиента через микросервис.
-	// URL сервиса для отправки email можно задать через переменную окружения EMAIL_SERVICE_URL.
-	emailServiceURL := os.Getenv("EMAIL_SERVICE_URL")
-	if emailServiceURL == "" {
-		emailServiceURL = "http://localhost:8080/email"
-	}
-
-	// Подготовка JSON-данных для email.
-	emailData := map[string]string{
-		"to":      user.Email,
-		"subject": "Payment Receipt - Example Corp",
-		"body":    "Dear " + clientName + ",\n\nPlease find attached your payment receipt.\n\nThank you for your purchase.",
-	}
-	emailDataJSON, err := json.Marshal(emailData)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Error preparing email data"})
-		return
-	}
-
-	// Формирование multipart/form-data запроса для отправки email.
-	var b bytes.Buffer
-	writer := multipart.NewWriter(&b)
-
-	// Добавляем поле "json" с данными письма.
-	fw, err := writer.CreateFormField("json")
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Error creating form field"})
-		return
-	}
-	_, err = fw.Write(emailDataJSON)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Error writing email JSON data"})
-		return
-	}
-
-	// Добавляем PDF‑чек как вложение.
-	fw, err = writer.CreateFormFile("file", "receipt.pdf")
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Error creating form file"})
-		return
-	}
-	_, err = fw.Write(pdfBytes)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Error attaching PDF file"})
-		return
-	}
-	writer.Close()
-
-	req, err := http.NewRequest("POST", emailServiceURL, &b)
+	err = email.Send(r.Context(), models.Email{
+		To:      user.Email,
+		Subject: "Payment Receipt - Example Corp",
+		Body:    "Dear " + clientName + ",\n\nPlease find attached your payment receipt.\n\nThank you for your purchase.",
+	}, email.Attachment{Filename: "receipt.pdf", Content: pdfBytes})
 	if err != nil {
+		logging.FromContext(r.Context()).Error("Error sending email receipt", zap.Error(err))
 		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Error creating email request"})
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Error sending email receipt"})
 		return
 	}
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-    if err != nil {
-        // Handle error making the request
-        log.Printf("Error making request: %v", err)
-        w.WriteHeader(http.StatusInternalServerError)
-        json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Error sending email receipt"})
-        return
-    }
-    defer resp.Body.Close() // Ensure the body is closed when done
-
-    if resp.StatusCode != http.StatusOK {
-        // Read the response body
-        bodyBytes, err := io.ReadAll(resp.Body) // Use io.ReadAll (or ioutil.ReadAll in older Go versions)
-        if err != nil {
-            log.Printf("Error reading response body: %v", err)
-        } else {
-            fmt.Println("Response Body:", string(bodyBytes))
-        }
-
-        w.WriteHeader(http.StatusInternalServerError)
-        json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Error sending email receipt"})
-        return
-    }
-
-    // Process the successful response here
-
-	defer resp.Body.Close()
 
 	// Обновляем статус транзакции до "completed".
 	transaction.Status = "completed"
-	transaction.UpdatedAt = time.Now().Format(time.RFC3339)
-	db.DB.Save(&transaction)
+	// Update сверяет версию: если транзакцию успел изменить другой процесс,
+	// статус не перезаписывается.
+	err = c.Transactions.Update(r.Context(), &transaction)
+	if errors.Is(err, repository.ErrVersionConflict) {
+		logging.FromContext(r.Context()).Warn("Transaction was modified concurrently, status left as is",
+			zap.Uint("transaction_id", transaction.ID))
+		if stored, err := c.Transactions.Get(r.Context(), transaction.ID); err == nil {
+			transaction = stored
+		}
+	} else if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to complete transaction", zap.Error(err))
+	}
 
 	// Подготовка данных для ответа.
 	responseData := map[string]interface{}{
@@ -287,6 +313,60 @@ func PaySubscription(w http.ResponseWriter, r *http.Request) {
 		"message":           "Payment successful. Receipt has been sent to " + user.Email,
 	}
 
+	outcome = "success"
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(Response{Status: "success", Message: "Payment successful", Data: responseData})
 }
+
+// Пределы выборки истории транзакций.
+const (
+	defaultTransactionsLimit = 50
+	maxTransactionsLimit     = 200
+)
+
+// ListTransactions возвращает историю транзакций для администратора.
+// Фильтры: subscription_id, status; постранично через limit и offset.
+// Список может читаться с реплики и отставать на несколько секунд.
+func (c *PaymentController) ListTransactions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	query := r.URL.Query()
+	filter := repository.TransactionFilter{Status: query.Get("status"), Limit: defaultTransactionsLimit}
+
+	invalid := func(message string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: message})
+	}
+	if value := query.Get("subscription_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			invalid("Invalid subscription_id")
+			return
+		}
+		filter.SubscriptionID = uint(id)
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxTransactionsLimit {
+			invalid(fmt.Sprintf("limit must be between 1 and %d", maxTransactionsLimit))
+			return
+		}
+		filter.Limit = limit
+	}
+	if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			invalid("Invalid offset")
+			return
+		}
+		filter.Offset = offset
+	}
+
+	transactions, err := c.Transactions.List(r.Context(), filter)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to retrieve transactions", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to retrieve transactions"})
+		return
+	}
+	json.NewEncoder(w).Encode(Response{Status: "success", Data: transactions})
+}
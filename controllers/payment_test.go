@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"ass3_part2/models"
+	"ass3_part2/money"
+	"ass3_part2/repository"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPaySubscriptionRejectsArchivedPlan(t *testing.T) {
+	a := newSQLiteAuthTest(t)
+	payments := NewPaymentController(a.repos)
+	ctx := context.Background()
+
+	a.register("heidi@example.com", "password-1")
+	user, err := a.repos.Users.GetByEmail(ctx, "heidi@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	price, err := money.New(99900, "KZT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := models.PremiumSubscription{Plan: "monthly", Period: 30, Price: price}
+	if err := a.repos.Plans.Create(ctx, &plan); err != nil {
+		t.Fatal(err)
+	}
+
+	pay := func() int {
+		t.Helper()
+		return a.call(http.HandlerFunc(payments.PaySubscription), "", Payment{
+			UserID:         uint(user.ID),
+			SubscriptionID: plan.ID,
+			PaymentForm: PaymentForm{
+				CardNumber:     "4111111111111111",
+				ExpirationDate: time.Now().AddDate(1, 0, 0).Format("01/2006"),
+				CVV:            "123",
+			},
+		}, nil)
+	}
+
+	if code := pay(); code != http.StatusOK {
+		t.Fatalf("pay for active plan: status %d", code)
+	}
+	if err := a.repos.Plans.Archive(ctx, plan.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if code := pay(); code != http.StatusConflict {
+		t.Fatalf("pay for archived plan: status %d, want 409", code)
+	}
+
+	transactions, err := a.repos.Transactions.List(ctx, repository.TransactionFilter{SubscriptionID: plan.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transactions) != 1 {
+		t.Fatalf("got %d transactions, want only the one for the active plan", len(transactions))
+	}
+}
@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+var errTrailingData = errors.New("request body must contain a single JSON object")
+
+// decodeJSON строго разбирает тело запроса: неизвестные поля и данные
+// после первого объекта считаются ошибкой.
+func decodeJSON(r *http.Request, dst interface{}) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dst); err != nil {
+		return err
+	}
+	if err := decoder.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return err
+		}
+		return errTrailingData
+	}
+	return nil
+}
+
+// writeDecodeError отвечает 413, если тело превысило предел маршрута, иначе 400.
+func writeDecodeError(w http.ResponseWriter, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Request body is too large"})
+		return
+	}
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Invalid JSON"})
+}
@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"ass3_part2/logging"
+	"ass3_part2/models"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+)
+
+// SessionView - активная сессия пользователя в ответе /me/sessions.
+type SessionView struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+// ListSessions возвращает активные сессии текущего пользователя.
+func (c *AuthController) ListSessions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	user, claims, err := c.currentUser(r)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Unauthorized"})
+		return
+	}
+
+	sessions, err := c.Sessions.ListActive(r.Context(), user.ID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to retrieve sessions", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to retrieve sessions"})
+		return
+	}
+
+	views := make([]SessionView, 0, len(sessions))
+	for _, session := range sessions {
+		views = append(views, SessionView{Session: session, Current: session.ID == claims.SessionID})
+	}
+	json.NewEncoder(w).Encode(Response{Status: "success", Data: views})
+}
+
+// RevokeSession отзывает одну из сессий текущего пользователя.
+func (c *AuthController) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	user, _, err := c.currentUser(r)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Unauthorized"})
+		return
+	}
+
+	session, err := c.Sessions.Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil || session.UserID != user.ID {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Session not found"})
+		return
+	}
+	if err := c.revokeSession(r.Context(), session.ID); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to revoke session", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to revoke session"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(Response{Status: "success", Message: "Session revoked successfully"})
+}
+
+// RevokeAllUserSessions (admin) отзывает все сессии указанного пользователя.
+func (c *AuthController) RevokeAllUserSessions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	userID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Invalid user ID"})
+		return
+	}
+
+	user, err := c.Users.Get(r.Context(), userID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "User not found"})
+		return
+	}
+	if err := c.revokeUserSessions(r.Context(), user.ID, ""); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to revoke user sessions", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to revoke user sessions"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(Response{Status: "success", Message: "All user sessions revoked successfully"})
+}
@@ -1,10 +1,13 @@
 package controllers
 
 import (
-	db "ass3_part2/db/migrations"
 	"ass3_part2/logging"
 	"ass3_part2/models"
+	"ass3_part2/money"
+	"ass3_part2/repository"
 	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 	"net/http"
 	"strconv"
@@ -16,38 +19,91 @@ type Response struct {
 	Data    interface{} `json:"data,omitempty"`
 }
 
-func CreateSubscription(w http.ResponseWriter, r *http.Request) {
+// SubscriptionRequest - изменяемые клиентом поля тарифа. Идентификатор, статус
+// и версию назначает сервер: статус меняется только архивированием.
+type SubscriptionRequest struct {
+	Plan   string      `json:"plan"`
+	Period uint        `json:"period"`
+	Price  money.Money `json:"price"`
+	// Version - ожидаемая версия при изменении (альтернатива If-Match).
+	Version int64 `json:"version,omitempty"`
+}
+
+// SubscriptionController управляет тарифами премиум-подписки.
+type SubscriptionController struct {
+	Plans repository.PlanRepository
+}
+
+func NewSubscriptionController(plans repository.PlanRepository) *SubscriptionController {
+	return &SubscriptionController{Plans: plans}
+}
+
+// subscriptionID берет идентификатор тарифа из пути, а для старых клиентов - из ?id=.
+func subscriptionID(r *http.Request) (uint, error) {
+	id := mux.Vars(r)["id"]
+	if id == "" {
+		id = r.URL.Query().Get("id")
+	}
+	parsed, err := strconv.ParseUint(id, 10, 64)
+	return uint(parsed), err
+}
+
+func (c *SubscriptionController) CreateSubscription(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	var subscription models.PremiumSubscription
-	if err := json.NewDecoder(r.Body).Decode(&subscription); err != nil {
-		logging.Logger.Error("Invalid JSON", zap.Error(err))
+	var req SubscriptionRequest
+	if err := decodeJSON(r, &req); err != nil {
+		logging.FromContext(r.Context()).Error("Invalid JSON", zap.Error(err))
+		writeDecodeError(w, err)
+		return
+	}
+	if err := req.Price.Validate(); err != nil {
 		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Invalid JSON"})
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Invalid price: " + err.Error()})
+		return
+	}
+	subscription := models.PremiumSubscription{
+		Plan:   req.Plan,
+		Period: req.Period,
+		Price:  req.Price,
+		Status: models.PlanStatusActive,
+	}
+	if err := c.Plans.Create(r.Context(), &subscription); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to create subscription", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to create subscription"})
 		return
 	}
-	db.DB.Create(&subscription)
+	w.Header().Set("ETag", versionETag(subscription.Version))
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(Response{Status: "success", Message: "Subscription created successfully", Data: subscription})
 }
 
-func GetSubscription(w http.ResponseWriter, r *http.Request) {
+func (c *SubscriptionController) GetSubscription(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	id := r.URL.Query().Get("id")
+	id, err := subscriptionID(r)
 	var subscription models.PremiumSubscription
-	if err := db.DB.First(&subscription, id).Error; err != nil {
-		logging.Logger.Error("Subscription not found", zap.Error(err))
+	if err == nil {
+		subscription, err = c.Plans.Get(r.Context(), id)
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Subscription not found", zap.Error(err))
 		w.WriteHeader(http.StatusNotFound)
 		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Subscription not found"})
 		return
 	}
+	w.Header().Set("ETag", versionETag(subscription.Version))
+	if header := r.Header.Get("If-None-Match"); header != "" && matchesETag(header, subscription.Version) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
 	json.NewEncoder(w).Encode(Response{Status: "success", Data: subscription})
 }
 
-func GetAllSubscriptions(w http.ResponseWriter, r *http.Request) {
+func (c *SubscriptionController) GetAllSubscriptions(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	var subscriptions []models.PremiumSubscription
-	if err := db.DB.Find(&subscriptions).Error; err != nil {
-		logging.Logger.Error("Failed to retrieve subscriptions", zap.Error(err))
+	subscriptions, err := c.Plans.List(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to retrieve subscriptions", zap.Error(err))
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to retrieve subscriptions"})
 		return
@@ -55,81 +111,150 @@ func GetAllSubscriptions(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(Response{Status: "success", Data: subscriptions})
 }
 
-func UpdateSubscription(w http.ResponseWriter, r *http.Request) {
+// UpdateSubscription изменяет тариф с оптимистичной блокировкой: ожидаемая версия
+// берется из If-Match или поля version в теле; при расхождении - 412, а если
+// клиент не передал ни того, ни другого - 428.
+func (c *SubscriptionController) UpdateSubscription(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	id := r.URL.Query().Get("id")
+	id, err := subscriptionID(r)
 	var subscription models.PremiumSubscription
-	if err := db.DB.First(&subscription, id).Error; err != nil {
-		logging.Logger.Error("Subscription not found", zap.Error(err))
+	if err == nil {
+		subscription, err = c.Plans.Get(r.Context(), id)
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Subscription not found", zap.Error(err))
 		w.WriteHeader(http.StatusNotFound)
 		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Subscription not found"})
 		return
 	}
+	current := subscription.Version
+	expected, ok := ifMatchVersion(r, current)
+	if !ok {
+		writePreconditionFailed(w)
+		return
+	}
 
-	if err := json.NewDecoder(r.Body).Decode(&subscription); err != nil {
-		logging.Logger.Error("Invalid JSON", zap.Error(err))
+	// Поля, которых нет в теле, сохраняют текущие значения. Версии начинаются
+	// с 1, поэтому 0 после разбора означает, что в теле ее нет.
+	req := SubscriptionRequest{Plan: subscription.Plan, Period: subscription.Period, Price: subscription.Price}
+	if err := decodeJSON(r, &req); err != nil {
+		logging.FromContext(r.Context()).Error("Invalid JSON", zap.Error(err))
+		writeDecodeError(w, err)
+		return
+	}
+	if err := req.Price.Validate(); err != nil {
 		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Invalid JSON"})
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Invalid price: " + err.Error()})
+		return
+	}
+	if req.Version == 0 {
+		if expected == 0 {
+			writePreconditionRequired(w)
+			return
+		}
+		req.Version = expected
+	}
+	// Версия из тела тоже должна совпадать с прочитанной.
+	if req.Version != current {
+		writePreconditionFailed(w)
 		return
 	}
+	subscription.Plan, subscription.Period, subscription.Price = req.Plan, req.Period, req.Price
 
-	db.DB.Save(&subscription)
+	err = c.Plans.Update(r.Context(), &subscription)
+	switch {
+	case errors.Is(err, repository.ErrVersionConflict):
+		writePreconditionFailed(w)
+		return
+	case errors.Is(err, repository.ErrNotFound):
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Subscription not found"})
+		return
+	case err != nil:
+		logging.FromContext(r.Context()).Error("Failed to update subscription", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to update subscription"})
+		return
+	}
+	w.Header().Set("ETag", versionETag(subscription.Version))
 	json.NewEncoder(w).Encode(Response{Status: "success", Message: "Subscription updated successfully", Data: subscription})
 }
 
-func DeleteSubscription(w http.ResponseWriter, r *http.Request) {
+func (c *SubscriptionController) DeleteSubscription(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	idStr := r.URL.Query().Get("id")
-	id, err := strconv.Atoi(idStr)
+	id, err := subscriptionID(r)
 	if err != nil {
-		logging.Logger.Error("Invalid subscription ID", zap.Error(err))
+		logging.FromContext(r.Context()).Error("Invalid subscription ID", zap.Error(err))
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Invalid subscription ID"})
 		return
 	}
 
-	tx := db.DB.Begin()
-	if tx.Error != nil {
-		logging.Logger.Error("Failed to start transaction", zap.Error(tx.Error))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to start transaction"})
-		return
+	// If-Match проверяется по текущей версии, а затем атомарно при записи.
+	var version int64
+	if header := r.Header.Get("If-Match"); header != "" {
+		subscription, err := c.Plans.Get(r.Context(), id)
+		if errors.Is(err, repository.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Subscription not found"})
+			return
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Failed to load subscription", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to delete subscription"})
+			return
+		}
+		var ok bool
+		if version, ok = ifMatchVersion(r, subscription.Version); !ok {
+			writePreconditionFailed(w)
+			return
+		}
 	}
 
-	// Delete related UserSubscriptions
-	if err := tx.Where("subscription_id = ?", id).Delete(&models.UserSubscription{}).Error; err != nil {
-		tx.Rollback()
-		logging.Logger.Error("Failed to delete related user subscriptions", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to delete related user subscriptions"})
+	// По умолчанию тариф архивируется: история подписок и транзакций остается.
+	// Физическое удаление (?hard=true) возможно только для тарифа без истории.
+	if r.URL.Query().Get("hard") != "true" {
+		err := c.Plans.Archive(r.Context(), id, version)
+		if errors.Is(err, repository.ErrVersionConflict) {
+			writePreconditionFailed(w)
+			return
+		}
+		if errors.Is(err, repository.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Subscription not found"})
+			return
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Failed to archive subscription", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to archive subscription"})
+			return
+		}
+		json.NewEncoder(w).Encode(Response{Status: "success", Message: "Subscription archived successfully"})
 		return
 	}
 
-	// Delete related Transactions
-	if err := tx.Where("subscription_id = ?", id).Delete(&models.Transaction{}).Error; err != nil {
-		tx.Rollback()
-		logging.Logger.Error("Failed to delete related transactions", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to delete related transactions"})
+	err = c.Plans.Delete(r.Context(), id, version)
+	switch {
+	case errors.Is(err, repository.ErrVersionConflict):
+		writePreconditionFailed(w)
 		return
-	}
-
-	// Delete the PremiumSubscription
-	if err := tx.Where("id = ?", id).Delete(&models.PremiumSubscription{}).Error; err != nil {
-		tx.Rollback()
-		logging.Logger.Error("Failed to delete subscription", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to delete subscription"})
+	case errors.Is(err, repository.ErrNotFound):
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Subscription not found"})
 		return
-	}
-
-	if err := tx.Commit().Error; err != nil {
-		logging.Logger.Error("Failed to commit transaction", zap.Error(err))
+	case errors.Is(err, repository.ErrInUse):
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Subscription has user subscriptions or transactions; archive it instead"})
+		return
+	case err != nil:
+		logging.FromContext(r.Context()).Error("Failed to delete subscription", zap.Error(err))
 		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to commit transaction"})
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to delete subscription"})
 		return
 	}
 
-	json.NewEncoder(w).Encode(Response{Status: "success", Message: "Subscription and related data deleted successfully"})
+	json.NewEncoder(w).Encode(Response{Status: "success", Message: "Subscription deleted successfully"})
 }
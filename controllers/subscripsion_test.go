@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"ass3_part2/logging"
+	"ass3_part2/models"
+	"ass3_part2/money"
+	"ass3_part2/repository"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestUpdateSubscriptionRequiresPrecondition(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	repos := repository.NewMemoryRepositories()
+	c := NewSubscriptionController(repos.Plans)
+
+	price, err := money.New(99900, "KZT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := models.PremiumSubscription{Plan: "monthly", Period: 1, Price: price}
+	if err := repos.Plans.Create(context.Background(), &plan); err != nil {
+		t.Fatal(err)
+	}
+
+	update := func(ifMatch string, version interface{}) int {
+		t.Helper()
+		body := map[string]interface{}{"plan": "monthly", "period": 1, "price": price}
+		if version != nil {
+			body["version"] = version
+		}
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPut, "/?id="+strconv.Itoa(int(plan.ID)), bytes.NewReader(payload))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rec := httptest.NewRecorder()
+		c.UpdateSubscription(rec, req)
+		return rec.Code
+	}
+
+	if code := update("", nil); code != http.StatusPreconditionRequired {
+		t.Fatalf("no If-Match and no version: status %d, want 428", code)
+	}
+	if code := update("", plan.Version+1); code != http.StatusPreconditionFailed {
+		t.Fatalf("stale body version: status %d, want 412", code)
+	}
+	if code := update(`"`+strconv.FormatInt(plan.Version+1, 10)+`"`, nil); code != http.StatusPreconditionFailed {
+		t.Fatalf("stale If-Match: status %d, want 412", code)
+	}
+	if code := update(versionETag(plan.Version), nil); code != http.StatusOK {
+		t.Fatalf("If-Match only: status %d, want 200", code)
+	}
+	if code := update("", plan.Version+1); code != http.StatusOK {
+		t.Fatalf("body version only: status %d, want 200", code)
+	}
+}
+
+func TestUpdateSubscriptionCannotChangeStatus(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	repos := repository.NewMemoryRepositories()
+	c := NewSubscriptionController(repos.Plans)
+
+	price, err := money.New(99900, "KZT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := models.PremiumSubscription{Plan: "monthly", Period: 1, Price: price, Status: models.PlanStatusActive}
+	if err := repos.Plans.Create(context.Background(), &plan); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Plans.Archive(context.Background(), plan.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	plan, _ = repos.Plans.Get(context.Background(), plan.ID)
+
+	payload, _ := json.Marshal(map[string]interface{}{"plan": "monthly", "status": models.PlanStatusActive, "version": plan.Version})
+	req := httptest.NewRequest(http.MethodPut, "/?id="+strconv.Itoa(int(plan.ID)), bytes.NewReader(payload))
+	rec := httptest.NewRecorder()
+	c.UpdateSubscription(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status in body: status %d, want 400", rec.Code)
+	}
+
+	payload, _ = json.Marshal(map[string]interface{}{"plan": "monthly plus", "version": plan.Version})
+	req = httptest.NewRequest(http.MethodPut, "/?id="+strconv.Itoa(int(plan.ID)), bytes.NewReader(payload))
+	rec = httptest.NewRecorder()
+	c.UpdateSubscription(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("rename: status %d, want 200", rec.Code)
+	}
+	updated, err := repos.Plans.Get(context.Background(), plan.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Status != models.PlanStatusArchived || updated.Plan != "monthly plus" || updated.Price != price {
+		t.Fatalf("updated plan = %+v, want renamed archived plan with the same price", updated)
+	}
+}
@@ -0,0 +1,291 @@
+package controllers
+
+import (
+	"ass3_part2/logging"
+	"ass3_part2/middleware"
+	"ass3_part2/models"
+	"ass3_part2/repository"
+	"ass3_part2/totp"
+	"context"
+	"encoding/json"
+	"errors"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+const (
+	totpIssuer        = "Example Corp"
+	recoveryCodeCount = 10
+)
+
+type TOTPCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type TOTPEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	URL    string `json:"otpauth_url"`
+}
+
+// generateRecoveryCodes заменяет коды восстановления пользователя новыми
+// и возвращает их в открытом виде - единственный раз, когда они видны.
+func (c *AuthController) generateRecoveryCodes(ctx context.Context, userID int64) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw, err := middleware.GenerateRandomToken(5)
+		if err != nil {
+			return nil, err
+		}
+		code := raw[:5] + "-" + raw[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, middleware.HashToken(middleware.NormalizeRecoveryCode(code)))
+	}
+	if err := c.SecondFactors.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// EnrollTOTP создает новый (еще не активный) TOTP-секрет пользователя.
+// Секрет начинает действовать после подтверждения кодом в ConfirmTOTP.
+func (c *AuthController) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	user, _, err := c.currentUser(r)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Unauthorized"})
+		return
+	}
+
+	if existing, err := c.SecondFactors.GetTOTP(r.Context(), user.ID); err == nil && existing.Enabled {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to generate TOTP secret", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to enroll two-factor authentication"})
+		return
+	}
+	encrypted, err := totp.EncryptSecret(secret)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to encrypt TOTP secret", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to enroll two-factor authentication"})
+		return
+	}
+
+	userTOTP := models.UserTOTP{UserID: user.ID, SecretEncrypted: encrypted}
+	if err := c.SecondFactors.SaveTOTP(r.Context(), &userTOTP); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to save TOTP secret", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to enroll two-factor authentication"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(Response{
+		Status:  "success",
+		Message: "Scan the code with an authenticator app and confirm it",
+		Data:    TOTPEnrollmentResponse{Secret: secret, URL: totp.URL(totpIssuer, user.Email, secret)},
+	})
+}
+
+// ConfirmTOTP активирует TOTP после проверки первого кода и выдает коды восстановления.
+func (c *AuthController) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	user, _, err := c.currentUser(r)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Unauthorized"})
+		return
+	}
+
+	var req TOTPCodeRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	userTOTP, err := c.SecondFactors.GetTOTP(r.Context(), user.ID)
+	if err != nil || userTOTP.Enabled {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "No pending two-factor enrollment"})
+		return
+	}
+	secret, err := totp.DecryptSecret(userTOTP.SecretEncrypted)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to decrypt TOTP secret", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to confirm two-factor authentication"})
+		return
+	}
+	step, ok := totp.Validate(secret, req.Code, time.Now(), userTOTP.LastUsedStep)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Invalid two-factor code"})
+		return
+	}
+
+	var codes []string
+	err = c.Tx.InTx(r.Context(), func(ctx context.Context) error {
+		if err := c.SecondFactors.UpdateTOTP(ctx, user.ID, map[string]interface{}{
+			"enabled":        true,
+			"last_used_step": step,
+			"confirmed_at":   time.Now(),
+		}); err != nil {
+			return err
+		}
+		var err error
+		codes, err = c.generateRecoveryCodes(ctx, user.ID)
+		return err
+	})
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to enable TOTP", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to confirm two-factor authentication"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(Response{Status: "success", Message: "Two-factor authentication enabled, store the recovery codes safely", Data: codes})
+}
+
+// DisableTOTP отключает второй фактор. Маршрут защищен RequireStepUp.
+func (c *AuthController) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	user, _, err := c.currentUser(r)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Unauthorized"})
+		return
+	}
+
+	if err := c.SecondFactors.Delete(r.Context(), user.ID); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to disable TOTP", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to disable two-factor authentication"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(Response{Status: "success", Message: "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes выдает новый набор кодов восстановления. Маршрут защищен RequireStepUp.
+func (c *AuthController) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	user, _, err := c.currentUser(r)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Unauthorized"})
+		return
+	}
+
+	var codes []string
+	err = c.Tx.InTx(r.Context(), func(ctx context.Context) error {
+		userTOTP, err := c.SecondFactors.GetTOTP(ctx, user.ID)
+		if errors.Is(err, repository.ErrNotFound) || err == nil && !userTOTP.Enabled {
+			return middleware.ErrTOTPNotEnabled
+		}
+		if err != nil {
+			return err
+		}
+		codes, err = c.generateRecoveryCodes(ctx, user.ID)
+		return err
+	})
+	if errors.Is(err, middleware.ErrTOTPNotEnabled) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Two-factor authentication is not enabled"})
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to regenerate recovery codes", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to regenerate recovery codes"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(Response{Status: "success", Data: codes})
+}
+
+// StepUp подтверждает второй фактор для текущей сессии и выдает access-токен
+// с обновленными auth_time и amr, которого достаточно для RequireStepUp.
+// Refresh-токен сессии остается прежним.
+func (c *AuthController) StepUp(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	user, claims, err := c.currentUser(r)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Unauthorized"})
+		return
+	}
+
+	var req TOTPCodeRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	valid, err := c.SecondFactor.Verify(r.Context(), user.ID, req.Code)
+	if errors.Is(err, middleware.ErrTOTPNotEnabled) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Two-factor authentication is not enabled"})
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to verify second factor", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to verify two-factor code"})
+		return
+	}
+	if !valid {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Invalid two-factor code"})
+		return
+	}
+
+	var tokens TokenResponse
+	err = c.Tx.InTx(r.Context(), func(ctx context.Context) error {
+		session, err := c.Sessions.Get(ctx, claims.SessionID)
+		if err != nil {
+			return err
+		}
+		if session.UserID != user.ID || session.RevokedAt != nil {
+			return repository.ErrNotFound
+		}
+		session.AuthTime = time.Now()
+		session.AMR = "pwd,otp"
+		if err := c.Sessions.UpdateFields(ctx, session.ID, map[string]interface{}{
+			"auth_time": session.AuthTime,
+			"amr":       session.AMR,
+		}); err != nil {
+			return err
+		}
+		accessToken, expiresAt, err := middleware.GenerateAccessToken(user, session)
+		if err != nil {
+			return err
+		}
+		tokens = TokenResponse{
+			AccessToken: accessToken,
+			TokenType:   "Bearer",
+			ExpiresIn:   int64(time.Until(expiresAt).Seconds()),
+		}
+		return nil
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Session not found"})
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to issue step-up tokens", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Status: "fail", Message: "Failed to issue tokens"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(Response{Status: "success", Message: "Step-up authentication succeeded", Data: tokens})
+}
@@ -0,0 +1,338 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Файлы миграций: sql/<драйвер>/<версия>_<имя>.up.sql и парный .down.sql.
+// Версии у драйверов общие, чтобы одна и та же схема имела один номер.
+//
+//go:embed sql/postgres/*.sql sql/sqlite/*.sql
+var migrationFiles embed.FS
+
+// migrationLockKey - ключ pg_advisory_lock, под которым применяются миграции,
+// чтобы одновременно стартующие реплики не выполняли их параллельно.
+const migrationLockKey = 727401
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationState - миграция и время ее применения (nil, если еще не применена).
+type MigrationState struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// migrationDialect описывает, чем диалекты различаются при ведении schema_migrations.
+type migrationDialect struct {
+	createTable string
+	insert      string
+	delete      string
+	// lock и unlock сериализуют миграции между процессами; пустые - без блокировки.
+	lock, unlock string
+}
+
+var migrationDialects = map[string]migrationDialect{
+	DriverPostgres: {
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    bigint PRIMARY KEY,
+			name       text NOT NULL,
+			applied_at timestamptz NOT NULL DEFAULT now()
+		)`,
+		insert: "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)",
+		delete: "DELETE FROM schema_migrations WHERE version = $1",
+		lock:   fmt.Sprintf("SELECT pg_advisory_lock(%d)", migrationLockKey),
+		unlock: fmt.Sprintf("SELECT pg_advisory_unlock(%d)", migrationLockKey),
+	},
+	// SQLite блокирует файл базы на время каждой транзакции миграции сам.
+	DriverSQLite: {
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    integer PRIMARY KEY,
+			name       text NOT NULL,
+			applied_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+		insert: "INSERT INTO schema_migrations (version, name) VALUES (?, ?)",
+		delete: "DELETE FROM schema_migrations WHERE version = ?",
+	},
+}
+
+// currentDialect возвращает имя драйвера подключенной базы.
+func currentDialect() (string, migrationDialect, error) {
+	name := DB.Dialector.Name()
+	dialect, ok := migrationDialects[name]
+	if !ok {
+		return name, dialect, fmt.Errorf("migrations are not supported for driver %q", name)
+	}
+	return name, dialect, nil
+}
+
+// LoadMigrations читает встроенные миграции драйвера и возвращает их по возрастанию версии.
+func LoadMigrations(driver string) ([]Migration, error) {
+	files, err := fs.Glob(migrationFiles, "sql/"+driver+"/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no migrations for driver %q", driver)
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, file := range files {
+		base := path.Base(file)
+		var direction string
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(base, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration %s: expected .up.sql or .down.sql suffix", base)
+		}
+		versionPart, name, ok := strings.Cut(strings.TrimSuffix(base, "."+direction+".sql"), "_")
+		version, err := strconv.ParseInt(versionPart, 10, 64)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: expected <version>_<name> file name", base)
+		}
+
+		content, err := migrationFiles.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		} else if migration.Name != name {
+			return nil, fmt.Errorf("migration %d: conflicting names %q and %q", version, migration.Name, name)
+		}
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s: both up and down files are required", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// LatestVersion возвращает версию последней встроенной миграции подключенного драйвера.
+func LatestVersion() (int64, error) {
+	driver, _, err := currentDialect()
+	if err != nil {
+		return 0, err
+	}
+	migrations, err := LoadMigrations(driver)
+	if err != nil {
+		return 0, err
+	}
+	if len(migrations) == 0 {
+		return 0, nil
+	}
+	return migrations[len(migrations)-1].Version, nil
+}
+
+// withMigrationLock выполняет fn на отдельном соединении, удерживая advisory lock.
+// Другие процессы ждут снятия блокировки и затем видят уже примененные миграции.
+func withMigrationLock(ctx context.Context, fn func(conn *sql.Conn, dialect migrationDialect) error) error {
+	_, dialect, err := currentDialect()
+	if err != nil {
+		return err
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if dialect.lock != "" {
+		if _, err := conn.ExecContext(ctx, dialect.lock); err != nil {
+			return fmt.Errorf("acquire migration lock: %w", err)
+		}
+		defer conn.ExecContext(context.WithoutCancel(ctx), dialect.unlock)
+	}
+
+	if _, err := conn.ExecContext(ctx, dialect.createTable); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+	return fn(conn, dialect)
+}
+
+func appliedMigrations(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int64]time.Time{}
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// runMigration выполняет SQL миграции и запись в schema_migrations в одной транзакции.
+func runMigration(ctx context.Context, conn *sql.Conn, statements, record string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, statements); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// MigrateUp применяет все непримененные миграции по возрастанию версии
+// и возвращает примененные.
+func MigrateUp(ctx context.Context) ([]Migration, error) {
+	driver, _, err := currentDialect()
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := LoadMigrations(driver)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	err = withMigrationLock(ctx, func(conn *sql.Conn, dialect migrationDialect) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := runMigration(ctx, conn, migration.Up, dialect.insert, migration.Version, migration.Name); err != nil {
+				return fmt.Errorf("migration %d_%s up: %w", migration.Version, migration.Name, err)
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// MigrateDown откатывает steps последних примененных миграций и возвращает откаченные.
+func MigrateDown(ctx context.Context, steps int) ([]Migration, error) {
+	driver, _, err := currentDialect()
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := LoadMigrations(driver)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	err = withMigrationLock(ctx, func(conn *sql.Conn, dialect migrationDialect) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			migration := migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if err := runMigration(ctx, conn, migration.Down, dialect.delete, migration.Version); err != nil {
+				return fmt.Errorf("migration %d_%s down: %w", migration.Version, migration.Name, err)
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// MigrationStatus возвращает все встроенные миграции с отметкой о применении.
+func MigrationStatus(ctx context.Context) ([]MigrationState, error) {
+	driver, _, err := currentDialect()
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := LoadMigrations(driver)
+	if err != nil {
+		return nil, err
+	}
+
+	var states []MigrationState
+	err = withMigrationLock(ctx, func(conn *sql.Conn, dialect migrationDialect) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range migrations {
+			state := MigrationState{Migration: migration}
+			if appliedAt, ok := applied[migration.Version]; ok {
+				state.AppliedAt = &appliedAt
+			}
+			states = append(states, state)
+		}
+		return nil
+	})
+	return states, err
+}
+
+// SchemaVersion возвращает версию последней примененной миграции (0, если их нет).
+func SchemaVersion(ctx context.Context) (int64, error) {
+	var version sql.NullInt64
+	err := DB.WithContext(ctx).Raw("SELECT max(version) FROM schema_migrations").Scan(&version).Error
+	if err != nil {
+		return 0, err
+	}
+	return version.Int64, nil
+}
+
+// CheckSchema проверяет, что применены все встроенные миграции.
+func CheckSchema(ctx context.Context) error {
+	latest, err := LatestVersion()
+	if err != nil {
+		return err
+	}
+	version, err := SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if version != latest {
+		return fmt.Errorf("schema version is %d, expected %d", version, latest)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/plugin/opentelemetry/tracing"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// replicaLagQuery возвращает отставание реплики в секундах. Если реплика
+// получает WAL с primary и проиграла все полученное, отставания нет, даже если
+// на primary давно не было записей. Без потоковой репликации (обрыв связи с
+// primary) равенство LSN ничего не говорит, и отставание считается по времени
+// последней проигранной транзакции. На primary возвращает 0.
+const replicaLagQuery = `SELECT CASE
+	WHEN NOT pg_is_in_recovery() THEN 0
+	WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn()
+		AND EXISTS (SELECT 1 FROM pg_stat_wal_receiver WHERE status = 'streaming') THEN 0
+	ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+END`
+
+// Replicas направляет запросы только на чтение на реплики; создается в main.
+// nil, если реплики не настроены.
+var Replicas *ReplicaSet
+
+type replica struct {
+	name string
+	db   *gorm.DB
+	// healthy выставляет монитор: реплика отвечает и отстает не больше MaxLag.
+	healthy atomic.Bool
+}
+
+// ReplicaSet выбирает реплику для чтения по кругу среди тех, что не отстают
+// больше допустимого, а если таких нет - возвращает primary.
+type ReplicaSet struct {
+	primary  *gorm.DB
+	replicas []*replica
+	maxLag   time.Duration
+	interval time.Duration
+	next     atomic.Uint64
+	stopOnce sync.Once
+	stop     chan struct{}
+}
+
+// NewReplicaSet подключается к репликам из dbConfig.Replica.DSNs и сразу проверяет их
+// отставание. Недоступная при старте реплика не мешает запуску: монитор
+// подключит ее в работу, когда она догонит primary.
+func NewReplicaSet(ctx context.Context, primary *gorm.DB, dbConfig DbConfig) (*ReplicaSet, error) {
+	set := &ReplicaSet{
+		primary:  primary,
+		maxLag:   dbConfig.Replica.MaxLag,
+		interval: dbConfig.Replica.CheckInterval,
+		stop:     make(chan struct{}),
+	}
+	for i, dsn := range dbConfig.Replica.DSNs {
+		dialector, err := replicaDialector(dsn, dbConfig.Pool)
+		if err != nil {
+			return nil, fmt.Errorf("replica %d: %w", i+1, err)
+		}
+		config := gormConfig()
+		config.DisableAutomaticPing = true
+		conn, err := gorm.Open(dialector, config)
+		if err != nil {
+			return nil, fmt.Errorf("replica %d: %w", i+1, err)
+		}
+		sqlDB, err := conn.DB()
+		if err != nil {
+			return nil, fmt.Errorf("replica %d: %w", i+1, err)
+		}
+		sqlDB.SetMaxOpenConns(dbConfig.Pool.MaxOpenConns)
+		sqlDB.SetMaxIdleConns(dbConfig.Pool.MaxIdleConns)
+		sqlDB.SetConnMaxLifetime(dbConfig.Pool.ConnMaxLifetime)
+		sqlDB.SetConnMaxIdleTime(dbConfig.Pool.ConnMaxIdleTime)
+		if err := conn.Use(tracing.NewPlugin(tracing.WithoutMetrics(), tracing.WithoutQueryVariables())); err != nil {
+			return nil, fmt.Errorf("replica %d: error enabling database tracing: %w", i+1, err)
+		}
+		set.replicas = append(set.replicas, &replica{name: fmt.Sprintf("replica-%d", i+1), db: conn})
+	}
+	set.check(ctx)
+	return set, nil
+}
+
+// replicaDialector разбирает DSN реплики (key=value или URL) и задает параметры
+// сессии через конфигурацию pgx, а не дописыванием к строке, которое ломает URL.
+func replicaDialector(dsn string, pool PoolConfig) (gorm.Dialector, error) {
+	connConfig, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+	connConfig.RuntimeParams["timezone"] = "UTC"
+	if pool.StatementTimeout > 0 {
+		connConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(pool.StatementTimeout.Milliseconds(), 10)
+	}
+	return postgres.New(postgres.Config{Conn: stdlib.OpenDB(*connConfig)}), nil
+}
+
+// Start запускает периодическую проверку отставания реплик.
+func (s *ReplicaSet) Start() {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), s.interval)
+				s.check(ctx)
+				cancel()
+			}
+		}
+	}()
+}
+
+// check измеряет отставание каждой реплики и обновляет ее состояние.
+func (s *ReplicaSet) check(ctx context.Context) {
+	for _, r := range s.replicas {
+		var lagSeconds float64
+		err := r.db.WithContext(ctx).Raw(replicaLagQuery).Scan(&lagSeconds).Error
+		lag := time.Duration(lagSeconds * float64(time.Second))
+		healthy := err == nil && lag <= s.maxLag
+
+		if was := r.healthy.Swap(healthy); was != healthy {
+			switch {
+			case err != nil:
+				log.Printf("Database %s is unavailable, reading from primary: %v", r.name, err)
+			case !healthy:
+				log.Printf("Database %s lags by %s (max %s), reading from primary", r.name, lag.Round(time.Millisecond), s.maxLag)
+			default:
+				log.Printf("Database %s is in rotation", r.name)
+			}
+		}
+	}
+}
+
+// Reader возвращает соединение для запросов только на чтение: следующую по
+// кругу исправную реплику или primary, если все реплики отстают.
+func (s *ReplicaSet) Reader(ctx context.Context) *gorm.DB {
+	for range s.replicas {
+		r := s.replicas[s.next.Add(1)%uint64(len(s.replicas))]
+		if r.healthy.Load() {
+			return r.db.WithContext(ctx)
+		}
+	}
+	return s.primary.WithContext(ctx)
+}
+
+// Close останавливает монитор и закрывает соединения с репликами.
+func (s *ReplicaSet) Close() {
+	if s == nil {
+		return
+	}
+	s.stopOnce.Do(func() { close(s.stop) })
+	for _, r := range s.replicas {
+		if sqlDB, err := r.db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}
+}
@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS rate_limit_counters;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS user_totps;
+DROP TABLE IF EXISTS revoked_tokens;
+DROP TABLE IF EXISTS password_reset_tokens;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS transactions;
+DROP TABLE IF EXISTS user_subscriptions;
+DROP TABLE IF EXISTS premium_subscriptions;
+DROP TABLE IF EXISTS roles;
+DROP TABLE IF EXISTS movies;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,143 @@
+-- Схема, которую раньше создавал AutoMigrate. IF NOT EXISTS позволяет
+-- принять миграцию на базе, уже созданной AutoMigrate, ничего не меняя.
+
+CREATE TABLE IF NOT EXISTS users (
+    id                   bigserial PRIMARY KEY,
+    name                 text        NOT NULL,
+    email                text        NOT NULL UNIQUE,
+    role_id              bigint,
+    password             text        NOT NULL,
+    is_confirmed         boolean,
+    confirmation_token   text,
+    confirmation_sent_at timestamptz,
+    created_at           timestamptz,
+    updated_at           timestamptz
+);
+-- В таблице, созданной AutoMigrate до подтверждения email, этой колонки нет.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS confirmation_sent_at timestamptz;
+
+CREATE TABLE IF NOT EXISTS movies (
+    id           bigserial PRIMARY KEY,
+    created_at   timestamptz,
+    updated_at   timestamptz,
+    deleted_at   timestamptz,
+    title        text,
+    description  text,
+    price        decimal,
+    genre        text,
+    release_date text,
+    image_url    text
+);
+CREATE INDEX IF NOT EXISTS idx_movies_deleted_at ON movies (deleted_at);
+
+CREATE TABLE IF NOT EXISTS roles (
+    id   bigserial PRIMARY KEY,
+    name text,
+    code text
+);
+
+CREATE TABLE IF NOT EXISTS premium_subscriptions (
+    id         bigserial PRIMARY KEY,
+    plan       varchar(100) NOT NULL,
+    period     bigint       NOT NULL,
+    status     varchar(50) DEFAULT 'active',
+    created_at text,
+    updated_at text,
+    deleted_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_premium_subscriptions_deleted_at ON premium_subscriptions (deleted_at);
+
+CREATE TABLE IF NOT EXISTS user_subscriptions (
+    id              bigserial PRIMARY KEY,
+    user_id         bigint NOT NULL,
+    subscription_id bigint NOT NULL,
+    start_date      date   NOT NULL,
+    end_date        date   NOT NULL,
+    created_at      text,
+    updated_at      text,
+    deleted_at      timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_user_subscriptions_deleted_at ON user_subscriptions (deleted_at);
+
+CREATE TABLE IF NOT EXISTS transactions (
+    id              bigserial PRIMARY KEY,
+    subscription_id bigint NOT NULL,
+    status          varchar(50) DEFAULT 'pending',
+    created_at      text,
+    updated_at      text,
+    deleted_at      timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_transactions_deleted_at ON transactions (deleted_at);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id           varchar(64) PRIMARY KEY,
+    user_id      bigint      NOT NULL,
+    user_agent   varchar(255),
+    ip           varchar(64),
+    last_seen_at timestamptz,
+    auth_time    timestamptz,
+    amr          varchar(64),
+    expires_at   timestamptz NOT NULL,
+    revoked_at   timestamptz,
+    created_at   timestamptz,
+    updated_at   timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id         bigserial PRIMARY KEY,
+    session_id varchar(64) NOT NULL,
+    user_id    bigint      NOT NULL,
+    token_hash varchar(64) NOT NULL,
+    expires_at timestamptz NOT NULL,
+    used_at    timestamptz,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session_id ON refresh_tokens (session_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refresh_tokens_token_hash ON refresh_tokens (token_hash);
+
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+    id         bigserial PRIMARY KEY,
+    user_id    bigint      NOT NULL,
+    token_hash varchar(64) NOT NULL,
+    expires_at timestamptz NOT NULL,
+    used_at    timestamptz,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_user_id ON password_reset_tokens (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_password_reset_tokens_token_hash ON password_reset_tokens (token_hash);
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti        varchar(64) PRIMARY KEY,
+    expires_at timestamptz NOT NULL,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires_at ON revoked_tokens (expires_at);
+
+CREATE TABLE IF NOT EXISTS user_totps (
+    user_id          bigint PRIMARY KEY,
+    secret_encrypted text    NOT NULL,
+    enabled          boolean NOT NULL DEFAULT false,
+    last_used_step   bigint,
+    confirmed_at     timestamptz,
+    created_at       timestamptz,
+    updated_at       timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id         bigserial PRIMARY KEY,
+    user_id    bigint      NOT NULL,
+    code_hash  varchar(64) NOT NULL,
+    used_at    timestamptz,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes (user_id);
+
+CREATE TABLE IF NOT EXISTS rate_limit_counters (
+    key          varchar(255) NOT NULL,
+    window_index bigint       NOT NULL,
+    count        bigint       NOT NULL,
+    expires_at   timestamptz  NOT NULL,
+    PRIMARY KEY (key, window_index)
+);
+CREATE INDEX IF NOT EXISTS idx_rate_limit_counters_expires_at ON rate_limit_counters (expires_at);
@@ -0,0 +1,29 @@
+-- Даты подписок и транзакций хранились строками RFC3339 (start_date/end_date - в date).
+-- Переводим их в timestamptz, сохраняя данные; нераспознанные строки становятся NULL.
+
+CREATE OR REPLACE FUNCTION pg_temp.to_timestamptz(value text) RETURNS timestamptz AS $$
+BEGIN
+    RETURN NULLIF(btrim(value), '')::timestamptz;
+EXCEPTION WHEN others THEN
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql STABLE;
+
+ALTER TABLE premium_subscriptions
+    ALTER COLUMN created_at TYPE timestamptz USING pg_temp.to_timestamptz(created_at),
+    ALTER COLUMN updated_at TYPE timestamptz USING pg_temp.to_timestamptz(updated_at);
+
+ALTER TABLE transactions
+    ALTER COLUMN created_at TYPE timestamptz USING pg_temp.to_timestamptz(created_at),
+    ALTER COLUMN updated_at TYPE timestamptz USING pg_temp.to_timestamptz(updated_at);
+
+-- Колонки date хранят календарный день без зоны: считаем его полночью UTC.
+ALTER TABLE user_subscriptions
+    ALTER COLUMN created_at TYPE timestamptz USING pg_temp.to_timestamptz(created_at),
+    ALTER COLUMN updated_at TYPE timestamptz USING pg_temp.to_timestamptz(updated_at),
+    ALTER COLUMN start_date TYPE timestamptz USING start_date::timestamp AT TIME ZONE 'UTC',
+    ALTER COLUMN end_date TYPE timestamptz USING end_date::timestamp AT TIME ZONE 'UTC';
+
+CREATE INDEX IF NOT EXISTS idx_user_subscriptions_end_date ON user_subscriptions (end_date);
+
+DROP FUNCTION pg_temp.to_timestamptz(text);
@@ -0,0 +1,7 @@
+ALTER TABLE transactions
+    DROP COLUMN IF EXISTS amount,
+    DROP COLUMN IF EXISTS currency;
+
+ALTER TABLE premium_subscriptions
+    DROP COLUMN IF EXISTS price_amount,
+    DROP COLUMN IF EXISTS price_currency;
@@ -0,0 +1,23 @@
+-- Цены и суммы хранятся в минимальных единицах валюты (bigint) вместе с кодом
+-- валюты ISO 4217. Существующие тарифы получают цену 100.00 KZT, которую раньше
+-- подставлял чек; транзакциям переносится цена их тарифа.
+ALTER TABLE premium_subscriptions
+    ADD COLUMN IF NOT EXISTS price_amount   bigint     NOT NULL DEFAULT 10000,
+    ADD COLUMN IF NOT EXISTS price_currency varchar(3) NOT NULL DEFAULT 'KZT';
+
+ALTER TABLE premium_subscriptions
+    ALTER COLUMN price_amount DROP DEFAULT,
+    ALTER COLUMN price_currency DROP DEFAULT;
+
+ALTER TABLE transactions
+    ADD COLUMN IF NOT EXISTS amount   bigint     NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS currency varchar(3) NOT NULL DEFAULT 'KZT';
+
+UPDATE transactions t
+SET amount = p.price_amount, currency = p.price_currency
+FROM premium_subscriptions p
+WHERE p.id = t.subscription_id;
+
+ALTER TABLE transactions
+    ALTER COLUMN amount DROP DEFAULT,
+    ALTER COLUMN currency DROP DEFAULT;
@@ -0,0 +1,18 @@
+-- Архивация тарифов и восстановленная история не откатываются: удаляются только ключи и индексы.
+DROP INDEX IF EXISTS idx_premium_subscriptions_status;
+DROP INDEX IF EXISTS idx_transactions_subscription_id;
+DROP INDEX IF EXISTS idx_user_subscriptions_user_id;
+DROP INDEX IF EXISTS idx_user_subscriptions_subscription_id;
+
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS fk_transactions_plan;
+ALTER TABLE user_subscriptions
+    DROP CONSTRAINT IF EXISTS fk_user_subscriptions_plan,
+    DROP CONSTRAINT IF EXISTS fk_user_subscriptions_user;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS fk_users_role;
+ALTER TABLE recovery_codes DROP CONSTRAINT IF EXISTS fk_recovery_codes_user;
+ALTER TABLE user_totps DROP CONSTRAINT IF EXISTS fk_user_totps_user;
+ALTER TABLE password_reset_tokens DROP CONSTRAINT IF EXISTS fk_password_reset_tokens_user;
+ALTER TABLE refresh_tokens
+    DROP CONSTRAINT IF EXISTS fk_refresh_tokens_user,
+    DROP CONSTRAINT IF EXISTS fk_refresh_tokens_session;
+ALTER TABLE sessions DROP CONSTRAINT IF EXISTS fk_sessions_user;
@@ -0,0 +1,69 @@
+-- Внешние ключи между таблицами. Финансовые записи (подписки пользователей и
+-- транзакции) ссылаются на тариф с ON DELETE RESTRICT: тариф с историей можно
+-- только архивировать. Служебные данные авторизации удаляются вместе с пользователем.
+
+-- Тарифы, которые раньше "удалялись" (soft delete вместе с историей), становятся
+-- архивными, а их подписки и транзакции возвращаются.
+UPDATE user_subscriptions SET deleted_at = NULL
+WHERE deleted_at IS NOT NULL
+  AND subscription_id IN (SELECT id FROM premium_subscriptions WHERE deleted_at IS NOT NULL);
+UPDATE transactions SET deleted_at = NULL
+WHERE deleted_at IS NOT NULL
+  AND subscription_id IN (SELECT id FROM premium_subscriptions WHERE deleted_at IS NOT NULL);
+UPDATE premium_subscriptions SET status = 'archived', deleted_at = NULL
+WHERE deleted_at IS NOT NULL;
+
+-- Осиротевшие данные авторизации бесполезны - удаляем их до добавления ключей.
+DELETE FROM sessions s WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = s.user_id);
+DELETE FROM refresh_tokens t WHERE NOT EXISTS (SELECT 1 FROM sessions s WHERE s.id = t.session_id);
+DELETE FROM password_reset_tokens t WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = t.user_id);
+DELETE FROM user_totps t WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = t.user_id);
+DELETE FROM recovery_codes c WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = c.user_id);
+
+ALTER TABLE sessions
+    ADD CONSTRAINT fk_sessions_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+ALTER TABLE refresh_tokens
+    ADD CONSTRAINT fk_refresh_tokens_session FOREIGN KEY (session_id) REFERENCES sessions (id) ON DELETE CASCADE,
+    ADD CONSTRAINT fk_refresh_tokens_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+ALTER TABLE password_reset_tokens
+    ADD CONSTRAINT fk_password_reset_tokens_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+ALTER TABLE user_totps
+    ADD CONSTRAINT fk_user_totps_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+ALTER TABLE recovery_codes
+    ADD CONSTRAINT fk_recovery_codes_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+-- Финансовые записи не удаляем, даже если они ссылаются на несуществующие строки:
+-- ключи создаются NOT VALID (проверяются для новых строк), а проверка старых
+-- выполняется, только если она проходит.
+ALTER TABLE users
+    ADD CONSTRAINT fk_users_role FOREIGN KEY (role_id) REFERENCES roles (id) ON DELETE RESTRICT NOT VALID;
+ALTER TABLE user_subscriptions
+    ADD CONSTRAINT fk_user_subscriptions_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE RESTRICT NOT VALID,
+    ADD CONSTRAINT fk_user_subscriptions_plan FOREIGN KEY (subscription_id) REFERENCES premium_subscriptions (id) ON DELETE RESTRICT NOT VALID;
+ALTER TABLE transactions
+    ADD CONSTRAINT fk_transactions_plan FOREIGN KEY (subscription_id) REFERENCES premium_subscriptions (id) ON DELETE RESTRICT NOT VALID;
+
+DO $$
+DECLARE
+    constraint_ref record;
+BEGIN
+    FOR constraint_ref IN
+        SELECT * FROM (VALUES
+            ('users', 'fk_users_role'),
+            ('user_subscriptions', 'fk_user_subscriptions_user'),
+            ('user_subscriptions', 'fk_user_subscriptions_plan'),
+            ('transactions', 'fk_transactions_plan')
+        ) AS c (table_name, constraint_name)
+    LOOP
+        BEGIN
+            EXECUTE format('ALTER TABLE %I VALIDATE CONSTRAINT %I', constraint_ref.table_name, constraint_ref.constraint_name);
+        EXCEPTION WHEN foreign_key_violation THEN
+            RAISE NOTICE '% has orphaned rows, % left NOT VALID', constraint_ref.table_name, constraint_ref.constraint_name;
+        END;
+    END LOOP;
+END $$;
+
+CREATE INDEX IF NOT EXISTS idx_user_subscriptions_subscription_id ON user_subscriptions (subscription_id);
+CREATE INDEX IF NOT EXISTS idx_user_subscriptions_user_id ON user_subscriptions (user_id);
+CREATE INDEX IF NOT EXISTS idx_transactions_subscription_id ON transactions (subscription_id);
+CREATE INDEX IF NOT EXISTS idx_premium_subscriptions_status ON premium_subscriptions (status);
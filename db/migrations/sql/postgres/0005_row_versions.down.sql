@@ -0,0 +1,2 @@
+ALTER TABLE transactions DROP COLUMN IF EXISTS version;
+ALTER TABLE premium_subscriptions DROP COLUMN IF EXISTS version;
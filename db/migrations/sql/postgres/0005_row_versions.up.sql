@@ -0,0 +1,4 @@
+-- Номер версии строки для оптимистичной блокировки: каждое обновление
+-- увеличивает его, а обновление по устаревшей версии отклоняется.
+ALTER TABLE premium_subscriptions ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 1;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 1;
@@ -0,0 +1,5 @@
+-- Откат допустим только после расшифровки значений: шифротексты уникальны,
+-- но поиск по email в открытом виде их не найдет.
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
+DROP INDEX IF EXISTS idx_users_email_index;
+ALTER TABLE users DROP COLUMN IF EXISTS email_index;
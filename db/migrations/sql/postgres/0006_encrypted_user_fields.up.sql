@@ -0,0 +1,10 @@
+-- Имя и email пользователей хранятся зашифрованными (encryption.Keyring), поэтому
+-- поиск и уникальность email обеспечивает blind index - HMAC нормализованного адреса.
+-- Строки, записанные до шифрования, заполняет команда "rotate-keys".
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_index text;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_index ON users (email_index);
+
+-- Шифротексты одного адреса различаются, уникальность по email больше ничего не дает.
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS uni_users_email;
+DROP INDEX IF EXISTS idx_users_email;
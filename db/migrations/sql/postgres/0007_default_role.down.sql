@@ -0,0 +1,2 @@
+-- Роль удаляется, только если ее еще никому не назначили.
+DELETE FROM roles WHERE code = 'user' AND NOT EXISTS (SELECT 1 FROM users u WHERE u.role_id = roles.id);
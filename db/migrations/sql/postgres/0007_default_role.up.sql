@@ -0,0 +1,11 @@
+-- Регистрация назначает роль "user", а fk_users_role (0004) не дает записать
+-- пользователя без существующей роли. Роль заводится здесь, а пользователи без
+-- роли (role_id 0 или NULL, записанные до появления ключа) получают ее.
+INSERT INTO roles (name, code)
+SELECT 'User', 'user'
+WHERE NOT EXISTS (SELECT 1 FROM roles WHERE code = 'user');
+
+UPDATE users SET role_id = (SELECT min(id) FROM roles WHERE code = 'user')
+WHERE role_id IS NULL OR NOT EXISTS (SELECT 1 FROM roles r WHERE r.id = users.role_id);
+
+ALTER TABLE users VALIDATE CONSTRAINT fk_users_role;
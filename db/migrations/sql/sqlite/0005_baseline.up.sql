@@ -0,0 +1,153 @@
+-- Схема для SQLite (локальный запуск и тесты без Postgres). Поддержка SQLite
+-- появилась после миграции 0005, поэтому база сразу создается в состоянии этой
+-- версии; следующие миграции добавляются для обоих драйверов под одним номером.
+
+CREATE TABLE roles (
+    id   integer PRIMARY KEY,
+    name text,
+    code text
+);
+
+CREATE TABLE users (
+    id                   integer PRIMARY KEY,
+    name                 text     NOT NULL,
+    email                text     NOT NULL UNIQUE,
+    role_id              integer REFERENCES roles (id) ON DELETE RESTRICT,
+    password             text     NOT NULL,
+    is_confirmed         numeric,
+    confirmation_token   text,
+    confirmation_sent_at datetime,
+    created_at           datetime,
+    updated_at           datetime
+);
+
+CREATE TABLE movies (
+    id           integer PRIMARY KEY,
+    created_at   datetime,
+    updated_at   datetime,
+    deleted_at   datetime,
+    title        text,
+    description  text,
+    price        numeric,
+    genre        text,
+    release_date text,
+    image_url    text
+);
+CREATE INDEX idx_movies_deleted_at ON movies (deleted_at);
+
+CREATE TABLE premium_subscriptions (
+    id             integer PRIMARY KEY,
+    plan           varchar(100) NOT NULL,
+    period         integer      NOT NULL,
+    price_amount   integer      NOT NULL,
+    price_currency varchar(3)   NOT NULL,
+    status         varchar(50) DEFAULT 'active',
+    version        integer      NOT NULL DEFAULT 1,
+    created_at     datetime,
+    updated_at     datetime,
+    deleted_at     datetime
+);
+CREATE INDEX idx_premium_subscriptions_deleted_at ON premium_subscriptions (deleted_at);
+CREATE INDEX idx_premium_subscriptions_status ON premium_subscriptions (status);
+
+CREATE TABLE user_subscriptions (
+    id              integer  PRIMARY KEY,
+    user_id         integer  NOT NULL REFERENCES users (id) ON DELETE RESTRICT,
+    subscription_id integer  NOT NULL REFERENCES premium_subscriptions (id) ON DELETE RESTRICT,
+    start_date      datetime NOT NULL,
+    end_date        datetime NOT NULL,
+    created_at      datetime,
+    updated_at      datetime,
+    deleted_at      datetime
+);
+CREATE INDEX idx_user_subscriptions_deleted_at ON user_subscriptions (deleted_at);
+CREATE INDEX idx_user_subscriptions_end_date ON user_subscriptions (end_date);
+CREATE INDEX idx_user_subscriptions_subscription_id ON user_subscriptions (subscription_id);
+CREATE INDEX idx_user_subscriptions_user_id ON user_subscriptions (user_id);
+
+CREATE TABLE transactions (
+    id              integer    PRIMARY KEY,
+    subscription_id integer    NOT NULL REFERENCES premium_subscriptions (id) ON DELETE RESTRICT,
+    amount          integer    NOT NULL,
+    currency        varchar(3) NOT NULL,
+    status          varchar(50) DEFAULT 'pending',
+    version         integer    NOT NULL DEFAULT 1,
+    created_at      datetime,
+    updated_at      datetime,
+    deleted_at      datetime
+);
+CREATE INDEX idx_transactions_deleted_at ON transactions (deleted_at);
+CREATE INDEX idx_transactions_subscription_id ON transactions (subscription_id);
+
+CREATE TABLE sessions (
+    id           varchar(64) PRIMARY KEY,
+    user_id      integer     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    user_agent   varchar(255),
+    ip           varchar(64),
+    last_seen_at datetime,
+    auth_time    datetime,
+    amr          varchar(64),
+    expires_at   datetime    NOT NULL,
+    revoked_at   datetime,
+    created_at   datetime,
+    updated_at   datetime
+);
+CREATE INDEX idx_sessions_user_id ON sessions (user_id);
+
+CREATE TABLE refresh_tokens (
+    id         integer     PRIMARY KEY,
+    session_id varchar(64) NOT NULL REFERENCES sessions (id) ON DELETE CASCADE,
+    user_id    integer     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    token_hash varchar(64) NOT NULL,
+    expires_at datetime    NOT NULL,
+    used_at    datetime,
+    created_at datetime
+);
+CREATE INDEX idx_refresh_tokens_session_id ON refresh_tokens (session_id);
+CREATE UNIQUE INDEX idx_refresh_tokens_token_hash ON refresh_tokens (token_hash);
+
+CREATE TABLE password_reset_tokens (
+    id         integer     PRIMARY KEY,
+    user_id    integer     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    token_hash varchar(64) NOT NULL,
+    expires_at datetime    NOT NULL,
+    used_at    datetime,
+    created_at datetime
+);
+CREATE INDEX idx_password_reset_tokens_user_id ON password_reset_tokens (user_id);
+CREATE UNIQUE INDEX idx_password_reset_tokens_token_hash ON password_reset_tokens (token_hash);
+
+CREATE TABLE revoked_tokens (
+    jti        varchar(64) PRIMARY KEY,
+    expires_at datetime    NOT NULL,
+    created_at datetime
+);
+CREATE INDEX idx_revoked_tokens_expires_at ON revoked_tokens (expires_at);
+
+CREATE TABLE user_totps (
+    user_id          integer PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    secret_encrypted text    NOT NULL,
+    enabled          numeric NOT NULL DEFAULT false,
+    last_used_step   integer,
+    confirmed_at     datetime,
+    created_at       datetime,
+    updated_at       datetime
+);
+
+CREATE TABLE recovery_codes (
+    id         integer     PRIMARY KEY,
+    user_id    integer     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash  varchar(64) NOT NULL,
+    used_at    datetime,
+    created_at datetime
+);
+CREATE INDEX idx_recovery_codes_user_id ON recovery_codes (user_id);
+
+CREATE TABLE rate_limit_counters (
+    key          varchar(255) NOT NULL,
+    window_index integer      NOT NULL,
+    count        integer      NOT NULL,
+    expires_at   datetime     NOT NULL,
+    PRIMARY KEY (key, window_index)
+);
+CREATE INDEX idx_rate_limit_counters_expires_at ON rate_limit_counters (expires_at);
@@ -0,0 +1,5 @@
+-- Blind index для поиска по зашифрованному email (см. postgres/0006). Встроенное
+-- ограничение UNIQUE (email) в SQLite не удалить без пересоздания таблицы; оно
+-- безвредно, так как шифротексты одного адреса различаются.
+ALTER TABLE users ADD COLUMN email_index text;
+CREATE UNIQUE INDEX idx_users_email_index ON users (email_index);
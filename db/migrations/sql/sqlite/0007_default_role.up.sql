@@ -0,0 +1,7 @@
+-- Роль "user" для регистрации (см. postgres/0007): role_id ссылается на roles.
+INSERT INTO roles (name, code)
+SELECT 'User', 'user'
+WHERE NOT EXISTS (SELECT 1 FROM roles WHERE code = 'user');
+
+UPDATE users SET role_id = (SELECT min(id) FROM roles WHERE code = 'user')
+WHERE role_id IS NULL OR NOT EXISTS (SELECT 1 FROM roles r WHERE r.id = users.role_id);
@@ -0,0 +1,119 @@
+package email
+
+import (
+	"ass3_part2/logging"
+	"ass3_part2/metrics"
+	"ass3_part2/models"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Attachment описывает файл, прикладываемый к письму.
+type Attachment struct {
+	Filename string
+	Content  []byte
+}
+
+// Транспорт otelhttp создает спан исходящего запроса и передает traceparent сервису email.
+var client = &http.Client{
+	Timeout:   10 * time.Second,
+	Transport: otelhttp.NewTransport(http.DefaultTransport),
+}
+
+// ServiceURL возвращает адрес микросервиса отправки email.
+// URL можно задать через переменную окружения EMAIL_SERVICE_URL.
+func ServiceURL() string {
+	if url := os.Getenv("EMAIL_SERVICE_URL"); url != "" {
+		return url
+	}
+	return "http://localhost:8080/email"
+}
+
+// Send отправляет письмо через микросервис в виде multipart/form-data:
+// поле "json" содержит данные письма, поля "file" - вложения.
+func Send(ctx context.Context, msg models.Email, attachments ...Attachment) error {
+	if err := send(ctx, msg, attachments); err != nil {
+		metrics.EmailDeliveryFailures.Inc()
+		return err
+	}
+	metrics.EmailsSent.Inc()
+	return nil
+}
+
+func send(ctx context.Context, msg models.Email, attachments []Attachment) error {
+	emailDataJSON, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal email data: %w", err)
+	}
+
+	var b bytes.Buffer
+	writer := multipart.NewWriter(&b)
+
+	fw, err := writer.CreateFormField("json")
+	if err != nil {
+		return fmt.Errorf("create form field: %w", err)
+	}
+	if _, err = fw.Write(emailDataJSON); err != nil {
+		return fmt.Errorf("write email JSON data: %w", err)
+	}
+
+	for _, attachment := range attachments {
+		fw, err = writer.CreateFormFile("file", attachment.Filename)
+		if err != nil {
+			return fmt.Errorf("create form file: %w", err)
+		}
+		if _, err = fw.Write(attachment.Content); err != nil {
+			return fmt.Errorf("attach %s: %w", attachment.Filename, err)
+		}
+	}
+	if err = writer.Close(); err != nil {
+		return fmt.Errorf("close multipart writer: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", ServiceURL(), &b)
+	if err != nil {
+		return fmt.Errorf("create email request: %w", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if requestID := logging.RequestIDFromContext(ctx); requestID != "" {
+		req.Header.Set("X-Request-ID", requestID)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send email request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("email service responded %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+	return nil
+}
+
+// Ping проверяет, что микросервис email отвечает. Любой ответ, кроме 5xx,
+// считается признаком доступности: эндпоинт принимает только POST.
+func Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, ServiceURL(), nil)
+	if err != nil {
+		return fmt.Errorf("create email ping request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("ping email service: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("email service responded %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// valuePrefix отличает зашифрованные значения от открытых, записанных до
+// включения шифрования: такие значения читаются как есть до перешифровки.
+const valuePrefix = "enc:v1:"
+
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+var (
+	ErrNoKeyring  = errors.New("encryption keyring is not configured")
+	ErrUnknownKey = errors.New("unknown encryption key id")
+	ErrMalformed  = errors.New("malformed encrypted value")
+)
+
+// Default используется сериализатором GORM и репозиториями; создается в main.
+var Default *Keyring
+
+// Keyring хранит ключи шифрования ключей (KEK) по идентификаторам и ключ blind index.
+//
+// Каждое значение шифруется собственным случайным ключом данных (DEK) AES-256-GCM,
+// а DEK - активным KEK. Формат: enc:v1:<key id>:<DEK под KEK>:<данные под DEK>.
+// Ротация сводится к добавлению нового KEK, назначению его активным и
+// перешифровке одних DEK (Rewrap) - сами данные не расшифровываются.
+type Keyring struct {
+	keys     map[string][]byte
+	activeID string
+	blindKey []byte
+}
+
+// NewKeyring создает связку ключей; activeID должен быть среди keys,
+// все ключи и blindKey - по 32 байта.
+func NewKeyring(keys map[string][]byte, activeID string, blindKey []byte) (*Keyring, error) {
+	for id, key := range keys {
+		if !keyIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("invalid key id %q", id)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key %q must be 32 bytes", id)
+		}
+	}
+	if _, ok := keys[activeID]; !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, activeID)
+	}
+	if len(blindKey) != 32 {
+		return nil, errors.New("blind index key must be 32 bytes")
+	}
+	return &Keyring{keys: keys, activeID: activeID, blindKey: blindKey}, nil
+}
+
+// LoadKeyringFromEnv читает ENCRYPTION_KEYS ("id:base64,id:base64"),
+// ENCRYPTION_ACTIVE_KEY и BLIND_INDEX_KEY (base64). ENCRYPTION_KEYS и
+// BLIND_INDEX_KEY обязательны: как и ключ TOTP, ключи не выводятся из секретов
+// в исходном коде. Данные, зашифрованные прежними выводимыми ключами, читаются,
+// если задать ENCRYPTION_KEYS = "default:" + base64(sha256("field-encryption:" +
+// прежний секрет JWT)) и BLIND_INDEX_KEY = base64(sha256("blind-index:" + он же)).
+func LoadKeyringFromEnv() (*Keyring, error) {
+	value := os.Getenv("ENCRYPTION_KEYS")
+	if value == "" {
+		return nil, errors.New("ENCRYPTION_KEYS is required")
+	}
+	encodedBlindKey := os.Getenv("BLIND_INDEX_KEY")
+	if encodedBlindKey == "" {
+		return nil, errors.New("BLIND_INDEX_KEY is required")
+	}
+
+	keys := map[string][]byte{}
+	var lastID string
+	for _, item := range strings.Split(value, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(item), ":")
+		if !ok {
+			return nil, fmt.Errorf("ENCRYPTION_KEYS: expected id:base64, got %q", item)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("ENCRYPTION_KEYS: key %q: %w", id, err)
+		}
+		if _, ok := keys[id]; ok {
+			return nil, fmt.Errorf("ENCRYPTION_KEYS: duplicate key id %q", id)
+		}
+		keys[id] = key
+		lastID = id
+	}
+
+	activeID := os.Getenv("ENCRYPTION_ACTIVE_KEY")
+	if activeID == "" {
+		if len(keys) > 1 {
+			return nil, errors.New("ENCRYPTION_ACTIVE_KEY is required when ENCRYPTION_KEYS lists several keys")
+		}
+		activeID = lastID
+	}
+
+	blindKey, err := base64.StdEncoding.DecodeString(encodedBlindKey)
+	if err != nil {
+		return nil, fmt.Errorf("BLIND_INDEX_KEY: %w", err)
+	}
+	return NewKeyring(keys, activeID, blindKey)
+}
+
+// ActiveKeyID возвращает идентификатор ключа, которым шифруются новые значения.
+func (k *Keyring) ActiveKeyID() string {
+	return k.activeID
+}
+
+func seal(key, plaintext, aad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func open(key, sealed, aad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrMalformed
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], aad)
+}
+
+// IsEncrypted сообщает, записано ли значение в зашифрованном формате.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, valuePrefix)
+}
+
+// KeyID возвращает идентификатор KEK зашифрованного значения.
+func KeyID(value string) (string, error) {
+	id, _, _, err := parse(value)
+	return id, err
+}
+
+func parse(value string) (keyID string, wrappedKey, data []byte, err error) {
+	parts := strings.Split(strings.TrimPrefix(value, valuePrefix), ":")
+	if !IsEncrypted(value) || len(parts) != 3 {
+		return "", nil, nil, ErrMalformed
+	}
+	if wrappedKey, err = base64.RawStdEncoding.DecodeString(parts[1]); err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	if data, err = base64.RawStdEncoding.DecodeString(parts[2]); err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	return parts[0], wrappedKey, data, nil
+}
+
+func format(keyID string, wrappedKey, data []byte) string {
+	return valuePrefix + keyID + ":" + base64.RawStdEncoding.EncodeToString(wrappedKey) + ":" +
+		base64.RawStdEncoding.EncodeToString(data)
+}
+
+// Encrypt шифрует значение новым DEK под активным ключом. aad привязывает
+// шифротекст к колонке ("users.email"): его нельзя подставить в другое поле.
+func (k *Keyring) Encrypt(aad, plaintext string) (string, error) {
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return "", err
+	}
+	data, err := seal(dek, []byte(plaintext), []byte(aad))
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := seal(k.keys[k.activeID], dek, []byte(k.activeID))
+	if err != nil {
+		return "", err
+	}
+	return format(k.activeID, wrapped, data), nil
+}
+
+// unwrap расшифровывает DEK значения ключом, которым он был зашифрован.
+func (k *Keyring) unwrap(keyID string, wrappedKey []byte) ([]byte, error) {
+	kek, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+	return open(kek, wrappedKey, []byte(keyID))
+}
+
+// Decrypt расшифровывает значение из Encrypt. Открытые значения, записанные
+// до включения шифрования, возвращаются без изменений.
+func (k *Keyring) Decrypt(aad, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	keyID, wrappedKey, data, err := parse(value)
+	if err != nil {
+		return "", err
+	}
+	dek, err := k.unwrap(keyID, wrappedKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dek, data, []byte(aad))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// Rewrap перешифровывает DEK значения активным ключом, не трогая данные.
+// Открытое значение шифруется целиком. Возвращает false, если менять нечего.
+func (k *Keyring) Rewrap(aad, value string) (string, bool, error) {
+	if !IsEncrypted(value) {
+		encrypted, err := k.Encrypt(aad, value)
+		return encrypted, err == nil, err
+	}
+	keyID, wrappedKey, data, err := parse(value)
+	if err != nil {
+		return "", false, err
+	}
+	if keyID == k.activeID {
+		return value, false, nil
+	}
+	dek, err := k.unwrap(keyID, wrappedKey)
+	if err != nil {
+		return "", false, err
+	}
+	wrapped, err := seal(k.keys[k.activeID], dek, []byte(k.activeID))
+	if err != nil {
+		return "", false, err
+	}
+	return format(k.activeID, wrapped, data), true, nil
+}
+
+// BlindIndex возвращает HMAC-SHA256 значения для поиска по равенству без
+// расшифровки. purpose разделяет индексы разных полей.
+func (k *Keyring) BlindIndex(purpose, value string) string {
+	mac := hmac.New(sha256.New, k.blindKey)
+	mac.Write([]byte(purpose + ":" + value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
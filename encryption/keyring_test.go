@@ -0,0 +1,112 @@
+package encryption
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newTestKeyring(t *testing.T, keys map[string][]byte, activeID string) *Keyring {
+	t.Helper()
+	k, err := NewKeyring(keys, activeID, bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+	k := newTestKeyring(t, map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}, "k1")
+	aad := Column("users", "email")
+
+	encrypted, err := k.Encrypt(aad, "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(encrypted) || strings.Contains(encrypted, "alice") {
+		t.Fatalf("Encrypt = %q, want an opaque enc:v1 value", encrypted)
+	}
+	if id, err := KeyID(encrypted); err != nil || id != "k1" {
+		t.Fatalf("KeyID = %q, %v; want k1", id, err)
+	}
+	plaintext, err := k.Decrypt(aad, encrypted)
+	if err != nil || plaintext != "alice@example.com" {
+		t.Fatalf("Decrypt = %q, %v; want alice@example.com", plaintext, err)
+	}
+
+	// Шифротекст привязан к колонке и не расшифровывается для другой.
+	if _, err := k.Decrypt(Column("users", "name"), encrypted); err == nil {
+		t.Fatal("Decrypt with another column succeeded")
+	}
+	// Открытые значения, записанные до шифрования, возвращаются как есть.
+	if plaintext, err := k.Decrypt(aad, "legacy@example.com"); err != nil || plaintext != "legacy@example.com" {
+		t.Fatalf("Decrypt(plaintext) = %q, %v", plaintext, err)
+	}
+}
+
+func TestDecryptAfterRotation(t *testing.T) {
+	oldKey, newKey := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+	aad := Column("users", "email")
+	before := newTestKeyring(t, map[string][]byte{"k1": oldKey}, "k1")
+	encrypted, err := before.Encrypt(aad, "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after := newTestKeyring(t, map[string][]byte{"k1": oldKey, "k2": newKey}, "k2")
+	if plaintext, err := after.Decrypt(aad, encrypted); err != nil || plaintext != "alice@example.com" {
+		t.Fatalf("Decrypt under the old key = %q, %v", plaintext, err)
+	}
+
+	rewrapped, changed, err := after.Rewrap(aad, encrypted)
+	if err != nil || !changed {
+		t.Fatalf("Rewrap = %v, %v; want changed", changed, err)
+	}
+	if id, _ := KeyID(rewrapped); id != "k2" {
+		t.Fatalf("rewrapped key id = %q, want k2", id)
+	}
+	if _, changed, err := after.Rewrap(aad, rewrapped); err != nil || changed {
+		t.Fatalf("second Rewrap = %v, %v; want unchanged", changed, err)
+	}
+
+	// После перешифровки старый KEK можно убрать из связки.
+	retired := newTestKeyring(t, map[string][]byte{"k2": newKey}, "k2")
+	if plaintext, err := retired.Decrypt(aad, rewrapped); err != nil || plaintext != "alice@example.com" {
+		t.Fatalf("Decrypt after retiring k1 = %q, %v", plaintext, err)
+	}
+}
+
+func TestDecryptRejectsUnknownKey(t *testing.T) {
+	aad := Column("users", "email")
+	other := newTestKeyring(t, map[string][]byte{"k9": bytes.Repeat([]byte{9}, 32)}, "k9")
+	encrypted, err := other.Encrypt(aad, "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k := newTestKeyring(t, map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}, "k1")
+	if _, err := k.Decrypt(aad, encrypted); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("Decrypt = %v, want ErrUnknownKey", err)
+	}
+	if _, _, err := k.Rewrap(aad, encrypted); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("Rewrap = %v, want ErrUnknownKey", err)
+	}
+	if _, err := NewKeyring(map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}, "k2", bytes.Repeat([]byte{7}, 32)); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("NewKeyring with unknown active id = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestBlindIndexSurvivesRotation(t *testing.T) {
+	purpose := Column("users", "email")
+	before := newTestKeyring(t, map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}, "k1")
+	after := newTestKeyring(t, map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32), "k2": bytes.Repeat([]byte{2}, 32)}, "k2")
+
+	index := before.BlindIndex(purpose, "alice@example.com")
+	if got := after.BlindIndex(purpose, "alice@example.com"); got != index {
+		t.Fatalf("blind index changed after KEK rotation: %q != %q", got, index)
+	}
+	if got := before.BlindIndex(Column("users", "name"), "alice@example.com"); got == index {
+		t.Fatal("blind index does not depend on purpose")
+	}
+}
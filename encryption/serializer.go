@@ -0,0 +1,56 @@
+package encryption
+
+import (
+	"context"
+	"fmt"
+	"gorm.io/gorm/schema"
+	"reflect"
+)
+
+func init() {
+	schema.RegisterSerializer("encrypted", Serializer{})
+}
+
+// Serializer прозрачно шифрует строковые поля моделей с тегом
+// gorm:"serializer:encrypted" ключами Default. Применяется при Create/Save и
+// чтении; обновления через map (Updates) нужно шифровать вызовом Column.
+type Serializer struct{}
+
+// Column возвращает значение aad для колонки: "<таблица>.<колонка>".
+func Column(table, column string) string {
+	return table + "." + column
+}
+
+func (Serializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var value string
+	switch v := dbValue.(type) {
+	case nil:
+		return nil
+	case string:
+		value = v
+	case []byte:
+		value = string(v)
+	default:
+		return fmt.Errorf("encrypted field %s: unsupported database value %T", field.Name, dbValue)
+	}
+	if Default == nil {
+		return ErrNoKeyring
+	}
+	plaintext, err := Default.Decrypt(Column(field.Schema.Table, field.DBName), value)
+	if err != nil {
+		return fmt.Errorf("decrypt %s: %w", field.Name, err)
+	}
+	field.ReflectValueOf(ctx, dst).SetString(plaintext)
+	return nil
+}
+
+func (Serializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	value, ok := fieldValue.(string)
+	if !ok {
+		return nil, fmt.Errorf("encrypted field %s: unsupported type %T", field.Name, fieldValue)
+	}
+	if Default == nil {
+		return nil, ErrNoKeyring
+	}
+	return Default.Encrypt(Column(field.Schema.Table, field.DBName), value)
+}
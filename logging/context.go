@@ -0,0 +1,63 @@
+package logging
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// RequestInfo - сведения о запросе для логов. Создается внешним middleware,
+// а внутренние (маршрутизация, аутентификация) дописывают в него поля,
+// поэтому они видны и тем, кто стоит в цепочке раньше.
+type RequestInfo struct {
+	RequestID string
+	UserID    string
+	Route     string
+}
+
+type requestInfoKey struct{}
+
+// NewContext сохраняет сведения о запросе в контексте.
+func NewContext(ctx context.Context, info *RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+// InfoFromContext возвращает сведения о запросе или nil, если их нет.
+func InfoFromContext(ctx context.Context) *RequestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*RequestInfo)
+	return info
+}
+
+// RequestIDFromContext возвращает идентификатор запроса из контекста.
+func RequestIDFromContext(ctx context.Context) string {
+	if info := InfoFromContext(ctx); info != nil {
+		return info.RequestID
+	}
+	return ""
+}
+
+// FromContext возвращает Logger с полями request_id, user_id и route текущего запроса,
+// а также trace_id и span_id активного спана.
+func FromContext(ctx context.Context) *zap.Logger {
+	fields := make([]zap.Field, 0, 5)
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		fields = append(fields,
+			zap.String("trace_id", spanContext.TraceID().String()),
+			zap.String("span_id", spanContext.SpanID().String()),
+		)
+	}
+	info := InfoFromContext(ctx)
+	if info == nil {
+		return Logger.With(fields...)
+	}
+	if info.RequestID != "" {
+		fields = append(fields, zap.String("request_id", info.RequestID))
+	}
+	if info.UserID != "" {
+		fields = append(fields, zap.String("user_id", info.UserID))
+	}
+	if info.Route != "" {
+		fields = append(fields, zap.String("route", info.Route))
+	}
+	return Logger.With(fields...)
+}
@@ -1,9 +1,16 @@
 package main
 
 import (
+	"ass3_part2/controllers"
 	db "ass3_part2/db/migrations"
+	"ass3_part2/encryption"
 	"ass3_part2/logging"
+	"ass3_part2/metrics"
+	"ass3_part2/middleware"
+	"ass3_part2/repository"
 	router2 "ass3_part2/router"
+	"ass3_part2/totp"
+	"ass3_part2/tracing"
 	"context"
 	"github.com/joho/godotenv"
 	"go.uber.org/zap"
@@ -11,6 +18,8 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 )
 
@@ -20,22 +29,174 @@ func init() {
 	}
 }
 
+// envDuration читает длительность из переменной окружения или возвращает значение по умолчанию.
+func envDuration(name string, fallback time.Duration) time.Duration {
+	if value := os.Getenv(name); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+		log.Printf("Invalid %s, using default: %q", name, value)
+	}
+	return fallback
+}
+
 func main() {
-	router := router2.NewRouter()
-	dbConfig := db.LoadDbConfigFromEnv()
-	db.NewDb(dbConfig)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		dbConfig, err := db.LoadDbConfigFromEnv()
+		if err != nil {
+			log.Fatal("Invalid database config: ", err)
+		}
+		if err := db.NewDb(context.Background(), dbConfig); err != nil {
+			log.Fatal(err)
+		}
+		err = runMigrate(context.Background(), os.Args[2:])
+		db.CloseDb()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Имя и email пользователей шифруются на уровне полей; ключи нужны до работы с БД.
+	keyring, err := encryption.LoadKeyringFromEnv()
+	if err != nil {
+		log.Fatal("Invalid encryption keys: ", err)
+	}
+	encryption.Default = keyring
+
+	if len(os.Args) > 1 && os.Args[1] == "rotate-keys" {
+		dbConfig, err := db.LoadDbConfigFromEnv()
+		if err != nil {
+			log.Fatal("Invalid database config: ", err)
+		}
+		if err := db.NewDb(context.Background(), dbConfig); err != nil {
+			log.Fatal(err)
+		}
+		err = runRotateKeys(context.Background(), keyring)
+		db.CloseDb()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	shutdownTracing, err := tracing.Init(context.Background())
+	if err != nil {
+		log.Fatal("Invalid tracing config: ", err)
+	}
+
+	trustedProxies, err := middleware.ParseCIDRs(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES: ", err)
+	}
+	middleware.TrustedProxies = trustedProxies
+
+	rateLimitConfig, err := middleware.LoadRateLimitConfigFromEnv()
+	if err != nil {
+		log.Fatal("Invalid rate limit config: ", err)
+	}
+	middleware.Limiter = middleware.NewKeyedLimiter(rateLimitConfig)
+
+	apiKeys, err := middleware.LoadAPIKeysFromEnv()
+	if err != nil {
+		log.Fatal("Invalid API keys: ", err)
+	}
+	middleware.APIKeys = apiKeys
+
+	corsConfig, err := middleware.LoadCORSConfigFromEnv()
+	if err != nil {
+		log.Fatal("Invalid CORS config: ", err)
+	}
+	middleware.CORSPolicy = corsConfig
+
+	hardeningConfig, err := middleware.LoadHardeningConfigFromEnv()
+	if err != nil {
+		log.Fatal("Invalid request hardening config: ", err)
+	}
+	middleware.Hardening = hardeningConfig
+
+	jwtKey, err := middleware.LoadJWTKeyFromEnv()
+	if err != nil {
+		log.Fatal("Invalid JWT signing key: ", err)
+	}
+	middleware.JwtKey = jwtKey
+
+	totpKey, err := totp.LoadEncryptionKeyFromEnv()
+	if err != nil {
+		log.Fatal("Invalid TOTP encryption key: ", err)
+	}
+	totp.EncryptionKey = totpKey
+
+	dbConfig, err := db.LoadDbConfigFromEnv()
+	if err != nil {
+		log.Fatal("Invalid database config: ", err)
+	}
+	if err := db.NewDb(context.Background(), dbConfig); err != nil {
+		log.Fatal(err)
+	}
+	// При MIGRATE_ON_START=false миграции применяются отдельно командой "migrate up".
+	if migrateOnStart, err := strconv.ParseBool(os.Getenv("MIGRATE_ON_START")); err != nil || migrateOnStart {
+		applied, err := db.MigrateUp(context.Background())
+		if err != nil {
+			log.Fatal("Error applying migrations: ", err)
+		}
+		for _, migration := range applied {
+			log.Printf("Applied migration %d_%s", migration.Version, migration.Name)
+		}
+	}
+	if sqlDB, err := db.DB.DB(); err == nil {
+		if err := metrics.RegisterDBStats(sqlDB, dbConfig.Dbname); err != nil {
+			log.Println("Error registering DB pool metrics:", err)
+		}
+	}
+
+	rateLimitStore, err := middleware.NewRateLimitStoreFromEnv(db.DB)
+	if err != nil {
+		log.Fatal("Invalid rate limit store: ", err)
+	}
+	middleware.SharedLimiter = rateLimitStore
+	stopCleanup := make(chan struct{})
+	if store, ok := rateLimitStore.(*middleware.PostgresRateLimitStore); ok {
+		store.StartCleanup(time.Minute, stopCleanup)
+	}
+
+	// Списки тарифов и история транзакций читаются с реплик, если они настроены.
+	repos := repository.NewGormRepositories(db.DB)
+	if len(dbConfig.Replica.DSNs) > 0 {
+		replicas, err := db.NewReplicaSet(context.Background(), db.DB, dbConfig)
+		if err != nil {
+			log.Fatal("Error connecting to database replicas: ", err)
+		}
+		replicas.Start()
+		db.Replicas = replicas
+		repos = repository.NewGormRepositoriesWithReplicas(db.DB, replicas)
+	}
+	secondFactor := middleware.NewSecondFactorVerifier(repos)
+	middleware.Revocations = middleware.NewRevocationStore(repos)
+	router := router2.NewRouter(router2.Dependencies{
+		Auth:          controllers.NewAuthController(repos, secondFactor),
+		Subscriptions: controllers.NewSubscriptionController(repos.Plans),
+		Payments:      controllers.NewPaymentController(repos),
+		Users:         repos.Users,
+		SecondFactor:  secondFactor,
+	})
+
 	// Указываем серверу использовать папку "static" для HTML, CSS и JS
 	http.Handle("/", http.FileServer(http.Dir("./static")))
 
-	err := logging.NewLogger()
+	err = logging.NewLogger()
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	// Запускаем сервер на порту 8081
 	server := &http.Server{
-		Addr:    ":8081",
-		Handler: router,
+		Addr:              ":8081",
+		Handler:           router,
+		ReadHeaderTimeout: envDuration("SERVER_READ_HEADER_TIMEOUT", 5*time.Second),
+		ReadTimeout:       envDuration("SERVER_READ_TIMEOUT", 15*time.Second),
+		WriteTimeout:      envDuration("SERVER_WRITE_TIMEOUT", 30*time.Second),
+		IdleTimeout:       envDuration("SERVER_IDLE_TIMEOUT", 60*time.Second),
 	}
 	go func() {
 		logging.Logger.Info("Сервер запущен: http://localhost:8081/index")
@@ -45,11 +206,15 @@ func main() {
 	}()
 
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 
 	<-quit
 	logging.Logger.Info("Получен сигнал завершения, остановка сервера...")
 
+	// /readyz начинает отвечать 503; ждем, пока балансировщик выведет нас из ротации.
+	controllers.BeginShutdown()
+	time.Sleep(envDuration("SHUTDOWN_DRAIN_DELAY", 5*time.Second))
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -59,6 +224,11 @@ func main() {
 		logging.Logger.Info("Сервер успешно остановлен.")
 	}
 
+	close(stopCleanup)
+	if err := shutdownTracing(ctx); err != nil {
+		logging.Logger.Error("Ошибка при сбросе трейсов:", zap.Error(err))
+	}
+	db.Replicas.Close()
 	db.CloseDb()
 	logging.Logger.Sync()
 }
@@ -0,0 +1,52 @@
+// Package metrics описывает метрики Prometheus, которые отдает /metrics.
+//
+// Метрик возвратов, глубины очереди исходящих писем и запусков задачи
+// продления подписок нет намеренно: возвратов, outbox и задачи продления в
+// сервисе пока нет (письма отправляются напрямую в EMAIL_SERVICE_URL). Их
+// метрики добавляются вместе с самими подсистемами.
+package metrics
+
+import (
+	"database/sql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "http_request_duration_seconds",
+	Help:    "HTTP request latency by method, route template and status code.",
+	Buckets: prometheus.DefBuckets,
+}, []string{"method", "route", "status"})
+
+var RateLimitRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_rate_limit_rejections_total",
+	Help: "Requests rejected by the rate limiter, by route template.",
+}, []string{"route"})
+
+var PanicsRecovered = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "http_panics_recovered_total",
+	Help: "Panics in HTTP handlers recovered by the Recovery middleware.",
+})
+
+// Payments считает попытки оплаты по исходу (success, invalid, declined, rejected, error) и платежному провайдеру.
+var Payments = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "payments_total",
+	Help: "Payment attempts by outcome and provider.",
+}, []string{"outcome", "provider"})
+
+var EmailsSent = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "email_sent_total",
+	Help: "Emails successfully handed over to the email service.",
+})
+
+var EmailDeliveryFailures = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "email_delivery_failures_total",
+	Help: "Failed calls to the email service.",
+})
+
+// RegisterDBStats публикует статистику пула соединений sql.DB (открытые, занятые, ожидания).
+// Метрики Go runtime и процесса регистрируются клиентской библиотекой по умолчанию.
+func RegisterDBStats(sqlDB *sql.DB, dbName string) error {
+	return prometheus.Register(collectors.NewDBStatsCollector(sqlDB, dbName))
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"ass3_part2/logging"
+	"ass3_part2/metrics"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// responseRecorder запоминает статус и размер ответа для логов и метрик.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// Unwrap позволяет http.ResponseController добраться до исходного ResponseWriter.
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// AccessLog пишет по строке на каждый запрос: метод, шаблон маршрута, статус,
+// размер ответа, длительность и IP клиента, - и учитывает запрос в гистограмме латентности.
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := newResponseRecorder(w)
+
+		next.ServeHTTP(recorder, r)
+		latency := time.Since(start)
+
+		route := "unmatched"
+		if info := logging.InfoFromContext(r.Context()); info != nil && info.Route != "" {
+			route = info.Route
+		}
+		logging.FromContext(r.Context()).Info("http request",
+			zap.String("method", r.Method),
+			zap.String("route_template", route),
+			zap.Int("status", recorder.status),
+			zap.Int("bytes", recorder.bytes),
+			zap.Duration("latency", latency),
+			zap.String("client_ip", ClientIP(r)),
+		)
+		metrics.HTTPRequestDuration.
+			WithLabelValues(r.Method, route, strconv.Itoa(recorder.status)).
+			Observe(latency.Seconds())
+	})
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// APIKeyStore проверяет API-ключи клиентов по SHA-256 хешу (HashToken).
+type APIKeyStore interface {
+	Valid(keyHash string) bool
+}
+
+// APIKeys - известные API-ключи; задаются в main. Пока nil, заголовок X-API-Key
+// не учитывается, и лимит считается по IP-адресу.
+var APIKeys APIKeyStore
+
+// StaticAPIKeys - набор хешей API-ключей из конфигурации.
+type StaticAPIKeys map[string]struct{}
+
+func (k StaticAPIKeys) Valid(keyHash string) bool {
+	_, ok := k[keyHash]
+	return ok
+}
+
+// LoadAPIKeysFromEnv читает API_KEY_HASHES - SHA-256 (hex) выданных ключей через
+// запятую; сами ключи в конфигурации не хранятся. Без переменной возвращает nil.
+func LoadAPIKeysFromEnv() (APIKeyStore, error) {
+	value := os.Getenv("API_KEY_HASHES")
+	if value == "" {
+		return nil, nil
+	}
+	keys := StaticAPIKeys{}
+	for _, item := range strings.Split(value, ",") {
+		keyHash := strings.ToLower(strings.TrimSpace(item))
+		if decoded, err := hex.DecodeString(keyHash); err != nil || len(decoded) != 32 {
+			return nil, fmt.Errorf("API_KEY_HASHES: %q is not a SHA-256 hex digest", item)
+		}
+		keys[keyHash] = struct{}{}
+	}
+	return keys, nil
+}
@@ -1,18 +1,75 @@
 package middleware
 
 import (
+	"ass3_part2/logging"
+	"context"
+	"errors"
 	"github.com/golang-jwt/jwt/v4"
 	"net/http"
+	"os"
 	"strings"
 )
 
-var JwtKey = []byte("kino_time_secret")
+// minJWTKeyLength - минимальная длина секрета подписи HS256 (256 бит).
+const minJWTKeyLength = 32
+
+// JwtKey - секрет подписи access-токенов; задается в main из JWT_SECRET.
+// Пока он не задан, токены не выпускаются и не принимаются.
+var JwtKey []byte
+
+// ErrNoJWTKey возвращается, если секрет подписи токенов не настроен.
+var ErrNoJWTKey = errors.New("JWT signing key is not configured")
+
+// LoadJWTKeyFromEnv читает секрет подписи из JWT_SECRET (не короче 32 байт).
+// Переменная обязательна: секрет не хранится в исходном коде.
+func LoadJWTKeyFromEnv() ([]byte, error) {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		return nil, errors.New("JWT_SECRET is required")
+	}
+	if len(secret) < minJWTKeyLength {
+		return nil, errors.New("JWT_SECRET must be at least 32 bytes")
+	}
+	return []byte(secret), nil
+}
 
 type Claims struct {
-	Email string `json:"email"`
+	Email     string           `json:"email"`
+	SessionID string           `json:"sid,omitempty"`
+	AuthTime  *jwt.NumericDate `json:"auth_time,omitempty"`
+	AMR       []string         `json:"amr,omitempty"`
 	jwt.RegisteredClaims
 }
 
+type claimsContextKey struct{}
+
+// ClaimsFromContext возвращает claims, сохраненные MiddlewareAuth в контексте запроса.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*Claims)
+	return claims, ok
+}
+
+// ParseToken проверяет подпись и срок действия токена и возвращает его claims.
+func ParseToken(tokenString string) (*Claims, error) {
+	if len(JwtKey) == 0 {
+		return nil, ErrNoJWTKey
+	}
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return JwtKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, jwt.ErrSignatureInvalid
+	}
+	return claims, nil
+}
+
 func MiddlewareAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
@@ -22,15 +79,33 @@ func MiddlewareAuth(next http.Handler) http.Handler {
 		}
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
-		claims := &Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return JwtKey, nil
-		})
-		if err != nil || !token.Valid {
+		claims, err := ParseToken(tokenString)
+		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
+		// Все выпускаемые токены привязаны к сессии и имеют jti; без них отзыв не проверить.
+		if claims.ID == "" || claims.SessionID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		revoked, err := Revocations.IsRevoked(r.Context(), claims)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if revoked {
+			http.Error(w, "Unauthorized: token has been revoked", http.StatusUnauthorized)
+			return
+		}
+		Revocations.touch(claims.SessionID, ClientIP(r))
+
+		if info := logging.InfoFromContext(r.Context()); info != nil {
+			info.UserID = claims.Subject
+		}
 
-		next.ServeHTTP(w, r)
+		ctx := context.WithValue(r.Context(), claimsContextKey{}, claims)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -1,14 +1,12 @@
 package middleware
 
 import (
-	db "ass3_part2/db/migrations"
-	"ass3_part2/models"
-	"github.com/golang-jwt/jwt/v4"
+	"ass3_part2/repository"
 	"net/http"
 	"strings"
 )
 
-func MiddlewareRole(requiredRole string) func(http.Handler) http.Handler {
+func MiddlewareRole(users repository.UserRepository, requiredRole string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			authHeader := r.Header.Get("Authorization")
@@ -18,24 +16,21 @@ func MiddlewareRole(requiredRole string) func(http.Handler) http.Handler {
 			}
 			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
-			claims := &Claims{}
-			token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-				return JwtKey, nil
-			})
-			if err != nil || !token.Valid {
+			claims, err := ParseToken(tokenString)
+			if err != nil {
 				http.Error(w, "Unauthorized", http.StatusUnauthorized)
 				return
 			}
 
-			var user models.User
-			if err := db.DB.Where("email = ?", claims.Email).First(&user).Error; err != nil {
+			user, err := users.GetByEmail(r.Context(), claims.Email)
+			if err != nil {
 				http.Error(w, "User not found", http.StatusUnauthorized)
 				return
 			}
 
 			// Fetch role from the roles table
-			var role models.Role
-			if err := db.DB.Where("id = ?", user.RoleID).First(&role).Error; err != nil {
+			role, err := users.RoleByID(r.Context(), user.RoleID)
+			if err != nil {
 				http.Error(w, "Role not found", http.StatusForbidden)
 				return
 			}
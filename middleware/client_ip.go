@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TrustedProxies - сети балансировщиков и прокси, которым разрешено передавать
+// адрес клиента в X-Forwarded-For. Задается из TRUSTED_PROXIES в main.
+var TrustedProxies []*net.IPNet
+
+// ParseCIDRs разбирает список сетей через запятую; одиночный IP считается сетью /32 (/128).
+func ParseCIDRs(value string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			if ip := net.ParseIP(item); ip != nil && ip.To4() != nil {
+				item += "/32"
+			} else {
+				item += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func isTrustedProxy(ip net.IP) bool {
+	for _, network := range TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP возвращает IP-адрес клиента. X-Forwarded-For учитывается, только если
+// запрос пришел от доверенного прокси: цепочка просматривается справа налево,
+// и первый недоверенный адрес считается адресом клиента.
+func ClientIP(r *http.Request) string {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	remoteIP := net.ParseIP(remote)
+	if remoteIP == nil || !isTrustedProxy(remoteIP) {
+		return remote
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if ip == nil {
+			break
+		}
+		if !isTrustedProxy(ip) {
+			return ip.String()
+		}
+		remote = ip.String()
+	}
+	return remote
+}
+
+// isHTTPS сообщает, пришел ли запрос по HTTPS. X-Forwarded-Proto учитывается,
+// только если соединение установлено доверенным прокси.
+func isHTTPS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	remoteIP := net.ParseIP(remote)
+	return remoteIP != nil && isTrustedProxy(remoteIP) && strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
@@ -1,23 +1,186 @@
 package middleware
 
 import (
+	"fmt"
+	"github.com/gorilla/mux"
 	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func CORSMiddleware(next http.Handler) http.Handler {
+type CORSConfig struct {
+	// AllowedOrigins - точные origin ("https://app.example.com") или шаблоны
+	// поддоменов ("https://*.example.com"). Пустой список запрещает кросс-доменные запросы.
+	AllowedOrigins   []string
+	AllowCredentials bool
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	// MaxAge - сколько браузер может кешировать ответ на preflight-запрос.
+	MaxAge time.Duration
+}
+
+func DefaultCORSConfig() CORSConfig {
+	return CORSConfig{
+		AllowedOrigins: []string{"http://localhost:8081"},
+		AllowedHeaders: []string{"Authorization", "Content-Type", "X-API-Key", "If-Match", "If-None-Match", StepUpHeader, RequestIDHeader},
+		ExposedHeaders: []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After", "ETag", RequestIDHeader},
+		MaxAge:         10 * time.Minute,
+	}
+}
+
+// CORSPolicy применяется роутером; задается из окружения в main.
+var CORSPolicy = DefaultCORSConfig()
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// LoadCORSConfigFromEnv читает CORS_ALLOWED_ORIGINS, CORS_ALLOW_CREDENTIALS,
+// CORS_ALLOWED_HEADERS и CORS_MAX_AGE (например, "10m").
+func LoadCORSConfigFromEnv() (CORSConfig, error) {
+	config := DefaultCORSConfig()
+	if value, ok := os.LookupEnv("CORS_ALLOWED_ORIGINS"); ok {
+		config.AllowedOrigins = splitList(value)
+	}
+	if value := os.Getenv("CORS_ALLOW_CREDENTIALS"); value != "" {
+		allow, err := strconv.ParseBool(value)
+		if err != nil {
+			return config, fmt.Errorf("CORS_ALLOW_CREDENTIALS: %w", err)
+		}
+		config.AllowCredentials = allow
+	}
+	if value := os.Getenv("CORS_ALLOWED_HEADERS"); value != "" {
+		config.AllowedHeaders = splitList(value)
+	}
+	if value := os.Getenv("CORS_MAX_AGE"); value != "" {
+		maxAge, err := time.ParseDuration(value)
+		if err != nil {
+			return config, fmt.Errorf("CORS_MAX_AGE: %w", err)
+		}
+		config.MaxAge = maxAge
+	}
+	for _, origin := range config.AllowedOrigins {
+		if origin == "*" && config.AllowCredentials {
+			return config, fmt.Errorf("CORS_ALLOWED_ORIGINS: \"*\" cannot be combined with credentials")
+		}
+	}
+	return config, nil
+}
+
+// originAllowed проверяет origin по списку; шаблон "https://*.example.com"
+// совпадает с любым поддоменом example.com, но не с самим example.com.
+func (c CORSConfig) originAllowed(origin string) bool {
+	parsed, err := url.Parse(origin)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return false
+	}
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		scheme, host, ok := strings.Cut(allowed, "://")
+		if !ok || !strings.HasPrefix(host, "*.") || !strings.EqualFold(scheme, parsed.Scheme) {
+			continue
+		}
+		suffix := strings.ToLower(host[1:])
+		if strings.HasSuffix(strings.ToLower(parsed.Host), suffix) && len(parsed.Host) > len(suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// addVary дописывает значения в Vary, не дублируя уже присутствующие.
+func addVary(h http.Header, values ...string) {
+	existing := map[string]bool{}
+	for _, line := range h.Values("Vary") {
+		for _, item := range strings.Split(line, ",") {
+			existing[strings.ToLower(strings.TrimSpace(item))] = true
+		}
+	}
+	for _, value := range values {
+		if !existing[strings.ToLower(value)] {
+			h.Add("Vary", value)
+			existing[strings.ToLower(value)] = true
+		}
+	}
+}
+
+var corsMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// routeMethods возвращает методы, для которых у роутера есть маршрут с путем запроса.
+func routeMethods(router *mux.Router, r *http.Request) []string {
+	var methods []string
+	for _, method := range corsMethods {
+		probe := r.Clone(r.Context())
+		probe.Method = method
+		var match mux.RouteMatch
+		if router.Match(probe, &match) && match.MatchErr == nil {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+// CORS - единая обработка CORS для всего сервиса. Оборачивает роутер целиком,
+// чтобы отвечать на preflight-запросы к маршрутам, не объявляющим OPTIONS;
+// список разрешенных методов берется из маршрутов, совпавших с путем.
+func CORS(config CORSConfig, router *mux.Router) http.Handler {
+	allowedHeaders := strings.Join(config.AllowedHeaders, ", ")
+	exposedHeaders := strings.Join(config.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(config.MaxAge / time.Second))
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "*")
-		w.Header().Set("Access-Control-Allow-Headers", "*")
-		w.Header().Set("Vary", "Origin")
-		w.Header().Set("Vary", "Access-Control-Request-Method")
-
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if preflight {
+			addVary(w.Header(), "Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers")
+		} else {
+			addVary(w.Header(), "Origin")
+		}
+
+		if origin == "" || !config.originAllowed(origin) {
+			if preflight {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			router.ServeHTTP(w, r)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		if config.AllowCredentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if preflight {
+			methods := routeMethods(router, r)
+			if len(methods) == 0 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+			if allowedHeaders != "" {
+				w.Header().Set("Access-Control-Allow-Headers", allowedHeaders)
+			}
+			w.Header().Set("Access-Control-Max-Age", maxAge)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if exposedHeaders != "" {
+			w.Header().Set("Access-Control-Expose-Headers", exposedHeaders)
+		}
+		router.ServeHTTP(w, r)
 	})
 }
-
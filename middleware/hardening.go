@@ -0,0 +1,149 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// APIContentSecurityPolicy запрещает интерпретировать JSON-ответы как документ.
+	APIContentSecurityPolicy = "default-src 'none'; frame-ancestors 'none'"
+	// StaticPageCSP разрешает статическим страницам только ресурсы с нашего origin.
+	StaticPageCSP = "default-src 'self'; img-src 'self' data:; style-src 'self' 'unsafe-inline'; frame-ancestors 'none'; base-uri 'self'; form-action 'self'"
+)
+
+type HardeningConfig struct {
+	// MaxBodyBytes - предельный размер тела запроса по умолчанию.
+	MaxBodyBytes int64
+	// RouteBodyBytes - пределы для отдельных маршрутов по шаблону mux (например, "/payment").
+	RouteBodyBytes map[string]int64
+	// RequestTimeout - дедлайн контекста запроса; его соблюдают запросы к базе и сервису email.
+	RequestTimeout time.Duration
+	// HSTSMaxAge - срок Strict-Transport-Security; 0 отключает заголовок.
+	HSTSMaxAge time.Duration
+}
+
+func DefaultHardeningConfig() HardeningConfig {
+	return HardeningConfig{
+		MaxBodyBytes: 64 << 10,
+		RouteBodyBytes: map[string]int64{
+			"/auth/register": 4 << 10,
+			"/auth/login":    4 << 10,
+			"/payment":       8 << 10,
+		},
+		RequestTimeout: 15 * time.Second,
+		HSTSMaxAge:     180 * 24 * time.Hour,
+	}
+}
+
+// Hardening применяется роутером; задается из окружения в main.
+var Hardening = DefaultHardeningConfig()
+
+// LoadHardeningConfigFromEnv читает настройки:
+//
+//	BODY_LIMIT_DEFAULT - предельный размер тела в байтах;
+//	BODY_LIMIT_ROUTES - пределы маршрутов вида "/payment=8192,/auth/login=4096";
+//	REQUEST_TIMEOUT - дедлайн обработки запроса (например, "15s");
+//	HSTS_MAX_AGE - срок HSTS (например, "4320h"), "0" отключает заголовок.
+func LoadHardeningConfigFromEnv() (HardeningConfig, error) {
+	config := DefaultHardeningConfig()
+
+	if value := os.Getenv("BODY_LIMIT_DEFAULT"); value != "" {
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || limit <= 0 {
+			return config, fmt.Errorf("BODY_LIMIT_DEFAULT: invalid size %q", value)
+		}
+		config.MaxBodyBytes = limit
+	}
+	if value := os.Getenv("BODY_LIMIT_ROUTES"); value != "" {
+		for _, item := range strings.Split(value, ",") {
+			route, sizeValue, ok := strings.Cut(strings.TrimSpace(item), "=")
+			if !ok {
+				return config, fmt.Errorf("BODY_LIMIT_ROUTES: invalid limit %q", item)
+			}
+			limit, err := strconv.ParseInt(sizeValue, 10, 64)
+			if err != nil || limit <= 0 {
+				return config, fmt.Errorf("BODY_LIMIT_ROUTES: invalid size %q", sizeValue)
+			}
+			config.RouteBodyBytes[route] = limit
+		}
+	}
+	if value := os.Getenv("REQUEST_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return config, fmt.Errorf("REQUEST_TIMEOUT: %w", err)
+		}
+		config.RequestTimeout = timeout
+	}
+	if value := os.Getenv("HSTS_MAX_AGE"); value != "" {
+		if value == "0" {
+			config.HSTSMaxAge = 0
+		} else {
+			maxAge, err := time.ParseDuration(value)
+			if err != nil {
+				return config, fmt.Errorf("HSTS_MAX_AGE: %w", err)
+			}
+			config.HSTSMaxAge = maxAge
+		}
+	}
+	return config, nil
+}
+
+// bodyLimit возвращает предельный размер тела для маршрута.
+func (c HardeningConfig) bodyLimit(route string) int64 {
+	if limit, ok := c.RouteBodyBytes[route]; ok {
+		return limit
+	}
+	return c.MaxBodyBytes
+}
+
+// LimitBody ограничивает размер тела запроса пределом маршрута. Запрос с заведомо
+// большим Content-Length отклоняется сразу, остальные обрываются при чтении
+// сверх предела (ошибка *http.MaxBytesError). Подключается через router.Use.
+func LimitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := Hardening.bodyLimit(routeTemplate(r))
+		if r.ContentLength > limit {
+			http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequestTimeout задает дедлайн контекста запроса, чтобы зависшая база или
+// внешний сервис не держали обработчик дольше Hardening.RequestTimeout.
+func RequestTimeout(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if Hardening.RequestTimeout <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), Hardening.RequestTimeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// SecurityHeaders выставляет стандартные защитные заголовки. CSP по умолчанию
+// рассчитана на JSON API; статические страницы заменяют ее на StaticPageCSP.
+// HSTS отправляется только по HTTPS.
+func SecurityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("Referrer-Policy", "no-referrer")
+		h.Set("Content-Security-Policy", APIContentSecurityPolicy)
+		if Hardening.HSTSMaxAge > 0 && isHTTPS(r) {
+			h.Set("Strict-Transport-Security", "max-age="+strconv.Itoa(int(Hardening.HSTSMaxAge/time.Second))+"; includeSubDomains")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"ass3_part2/models"
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+// RateLimitStore - общее для всех реплик хранилище лимитов.
+type RateLimitStore interface {
+	Allow(ctx context.Context, key string, policy RateLimitPolicy) (RateLimitResult, error)
+}
+
+// SharedLimiter используется вместо локального Limiter, если задан.
+// Выбирается переменной RATE_LIMIT_STORE (memory | postgres).
+var SharedLimiter RateLimitStore
+
+// errStoreUnavailable возвращается, пока хранилище выведено из работы после сбоя.
+var errStoreUnavailable = errors.New("rate limit store is temporarily unavailable")
+
+// PostgresRateLimitStore считает запросы в скользящем окне по счетчикам в таблице
+// rate_limit_counters: вес предыдущего окна убывает пропорционально прошедшей
+// доле текущего. Длина окна - время полного пополнения корзины (Burst / Rate).
+type PostgresRateLimitStore struct {
+	db *gorm.DB
+	// Backoff - сколько после ошибки запросы обслуживает локальный лимитер,
+	// чтобы недоступная БД не добавляла задержку каждому запросу.
+	Backoff time.Duration
+
+	mu               sync.Mutex
+	unavailableUntil time.Time
+}
+
+func NewPostgresRateLimitStore(db *gorm.DB) *PostgresRateLimitStore {
+	return &PostgresRateLimitStore{db: db, Backoff: 10 * time.Second}
+}
+
+// NewRateLimitStoreFromEnv создает хранилище по RATE_LIMIT_STORE; для "memory"
+// (значение по умолчанию) возвращает nil, и используется только локальный лимитер.
+func NewRateLimitStoreFromEnv(db *gorm.DB) (RateLimitStore, error) {
+	switch store := os.Getenv("RATE_LIMIT_STORE"); store {
+	case "", "memory":
+		return nil, nil
+	case "postgres":
+		return NewPostgresRateLimitStore(db), nil
+	default:
+		return nil, fmt.Errorf("unknown RATE_LIMIT_STORE %q", store)
+	}
+}
+
+func windowLength(policy RateLimitPolicy) time.Duration {
+	if policy.Rate <= 0 || policy.Burst <= 0 {
+		return time.Minute
+	}
+	return time.Duration(float64(policy.Burst) / float64(policy.Rate) * float64(time.Second))
+}
+
+func (s *PostgresRateLimitStore) Allow(ctx context.Context, key string, policy RateLimitPolicy) (RateLimitResult, error) {
+	s.mu.Lock()
+	unavailable := time.Now().Before(s.unavailableUntil)
+	s.mu.Unlock()
+	if unavailable {
+		return RateLimitResult{}, errStoreUnavailable
+	}
+
+	result, err := s.allow(ctx, key, policy)
+	if err != nil {
+		s.mu.Lock()
+		s.unavailableUntil = time.Now().Add(s.Backoff)
+		s.mu.Unlock()
+	}
+	return result, err
+}
+
+func (s *PostgresRateLimitStore) allow(ctx context.Context, key string, policy RateLimitPolicy) (RateLimitResult, error) {
+	now := time.Now()
+	length := windowLength(policy)
+	window := now.UnixNano() / int64(length)
+	elapsed := time.Duration(now.UnixNano() - window*int64(length))
+
+	var current int64
+	err := s.db.WithContext(ctx).Raw(`
+		INSERT INTO rate_limit_counters (key, window_index, count, expires_at)
+		VALUES (?, ?, 1, ?)
+		ON CONFLICT (key, window_index) DO UPDATE SET count = rate_limit_counters.count + 1
+		RETURNING count`,
+		key, window, now.Add(2*length)).Scan(&current).Error
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+
+	var previous int64
+	err = s.db.WithContext(ctx).Model(&models.RateLimitCounter{}).
+		Where("key = ? AND window_index = ?", key, window-1).
+		Select("COALESCE(SUM(count), 0)").Scan(&previous).Error
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+
+	limit := float64(policy.Burst)
+	weight := 1 - float64(elapsed)/float64(length)
+	// Текущий запрос уже учтен в current, поэтому отклоняем, только если лимит превышен.
+	count := float64(previous)*weight + float64(current)
+
+	result := RateLimitResult{
+		Allowed:   count <= limit,
+		Limit:     policy.Burst,
+		Remaining: int(math.Max(0, math.Floor(limit-count))),
+		Reset:     length - elapsed,
+	}
+	if !result.Allowed {
+		result.RetryAfter = retryAfter(float64(previous), float64(current), limit, elapsed, length)
+	}
+	return result, nil
+}
+
+// retryAfter оценивает, когда взвешенный счетчик опустится ниже лимита.
+func retryAfter(previous, current, limit float64, elapsed, length time.Duration) time.Duration {
+	remaining := length - elapsed
+	if current < limit && previous > 0 {
+		// Хватит затухания предыдущего окна в пределах текущего.
+		wait := float64(remaining) - float64(length)*(limit-current)/previous
+		return time.Duration(math.Max(wait, 0))
+	}
+	// Нужно дождаться следующего окна, где текущий счетчик станет предыдущим.
+	wait := float64(remaining) + float64(length)*(1-limit/current)
+	return time.Duration(math.Max(wait, 0))
+}
+
+// StartCleanup периодически удаляет счетчики истекших окон, пока не закрыт stop.
+func (s *PostgresRateLimitStore) StartCleanup(interval time.Duration, stop <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				s.db.Where("expires_at < ?", time.Now()).Delete(&models.RateLimitCounter{})
+			}
+		}
+	}()
+}
@@ -1,17 +1,266 @@
 package middleware
 
 import (
+	"ass3_part2/logging"
+	"ass3_part2/metrics"
 	"ass3_part2/models"
+	"container/list"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
 	"golang.org/x/time/rate"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
-var Limiter = rate.NewLimiter(1, 1) // запрос,сек
+// RateLimitPolicy задает скорость пополнения (запросов в секунду) и размер корзины.
+type RateLimitPolicy struct {
+	Rate  rate.Limit
+	Burst int
+}
+
+type RateLimitConfig struct {
+	Default RateLimitPolicy
+	// Routes - политики для отдельных маршрутов по шаблону mux (например, "/payment").
+	Routes map[string]RateLimitPolicy
+	// IdleTTL - через сколько простоя корзина клиента удаляется.
+	IdleTTL time.Duration
+	// MaxKeys - сколько корзин держится в памяти; при превышении вытесняются самые давние.
+	MaxKeys int
+}
+
+func DefaultRateLimitConfig() RateLimitConfig {
+	return RateLimitConfig{
+		Default: RateLimitPolicy{Rate: 5, Burst: 10},
+		Routes: map[string]RateLimitPolicy{
+			"/payment":              {Rate: 0.5, Burst: 3},
+			"/auth/login":           {Rate: 0.2, Burst: 5},
+			"/auth/password/forgot": {Rate: 0.1, Burst: 3},
+		},
+		IdleTTL: 10 * time.Minute,
+		MaxKeys: 10000,
+	}
+}
+
+// LoadRateLimitConfigFromEnv читает настройки лимитов:
+//
+//	RATE_LIMIT_RPS, RATE_LIMIT_BURST - политика по умолчанию;
+//	RATE_LIMIT_ROUTES - политики маршрутов вида "/payment=0.5:3,/auth/login=0.2:5";
+//	RATE_LIMIT_IDLE_TTL, RATE_LIMIT_MAX_KEYS - вытеснение неактивных корзин.
+func LoadRateLimitConfigFromEnv() (RateLimitConfig, error) {
+	config := DefaultRateLimitConfig()
+
+	if value := os.Getenv("RATE_LIMIT_RPS"); value != "" {
+		rps, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return config, fmt.Errorf("RATE_LIMIT_RPS: %w", err)
+		}
+		config.Default.Rate = rate.Limit(rps)
+	}
+	if value := os.Getenv("RATE_LIMIT_BURST"); value != "" {
+		burst, err := strconv.Atoi(value)
+		if err != nil {
+			return config, fmt.Errorf("RATE_LIMIT_BURST: %w", err)
+		}
+		config.Default.Burst = burst
+	}
+	if value := os.Getenv("RATE_LIMIT_ROUTES"); value != "" {
+		for _, item := range strings.Split(value, ",") {
+			route, policy, ok := strings.Cut(strings.TrimSpace(item), "=")
+			rpsValue, burstValue, ok2 := strings.Cut(policy, ":")
+			if !ok || !ok2 {
+				return config, fmt.Errorf("RATE_LIMIT_ROUTES: invalid policy %q", item)
+			}
+			rps, err := strconv.ParseFloat(rpsValue, 64)
+			if err != nil {
+				return config, fmt.Errorf("RATE_LIMIT_ROUTES: %w", err)
+			}
+			burst, err := strconv.Atoi(burstValue)
+			if err != nil {
+				return config, fmt.Errorf("RATE_LIMIT_ROUTES: %w", err)
+			}
+			config.Routes[route] = RateLimitPolicy{Rate: rate.Limit(rps), Burst: burst}
+		}
+	}
+	if value := os.Getenv("RATE_LIMIT_IDLE_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil {
+			return config, fmt.Errorf("RATE_LIMIT_IDLE_TTL: %w", err)
+		}
+		config.IdleTTL = ttl
+	}
+	if value := os.Getenv("RATE_LIMIT_MAX_KEYS"); value != "" {
+		maxKeys, err := strconv.Atoi(value)
+		if err != nil {
+			return config, fmt.Errorf("RATE_LIMIT_MAX_KEYS: %w", err)
+		}
+		if maxKeys <= 0 {
+			return config, fmt.Errorf("RATE_LIMIT_MAX_KEYS must be positive, got %d", maxKeys)
+		}
+		config.MaxKeys = maxKeys
+	}
+	return config, nil
+}
+
+type bucket struct {
+	key      string
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// KeyedLimiter держит отдельную корзину токенов на каждый ключ клиента
+// и вытесняет корзины по LRU и времени простоя.
+type KeyedLimiter struct {
+	config  RateLimitConfig
+	mu      sync.Mutex
+	buckets map[string]*list.Element
+	lru     *list.List
+}
+
+func NewKeyedLimiter(config RateLimitConfig) *KeyedLimiter {
+	return &KeyedLimiter{
+		config:  config,
+		buckets: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+var Limiter = NewKeyedLimiter(DefaultRateLimitConfig())
+
+// Policy возвращает политику для шаблона маршрута и имя корзины, в которую он попадает.
+// Маршруты без собственной политики делят общую корзину клиента.
+func (l *KeyedLimiter) Policy(route string) (string, RateLimitPolicy) {
+	if policy, ok := l.config.Routes[route]; ok {
+		return route, policy
+	}
+	return "default", l.config.Default
+}
 
+// RateLimitResult - решение лимитера и данные для заголовков RateLimit-*.
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset - через сколько корзина наполнится полностью.
+	Reset time.Duration
+	// RetryAfter - через сколько отклоненный запрос будет пропущен.
+	RetryAfter time.Duration
+}
+
+// Allow резервирует токен из корзины ключа, создавая ее при первом обращении.
+// Если токен появится только в будущем, резерв отменяется и запрос отклоняется.
+func (l *KeyedLimiter) Allow(key string, policy RateLimitPolicy) RateLimitResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.evict(now)
+
+	var b *bucket
+	if element, ok := l.buckets[key]; ok {
+		l.lru.MoveToFront(element)
+		b = element.Value.(*bucket)
+	} else {
+		b = &bucket{key: key, limiter: rate.NewLimiter(policy.Rate, policy.Burst)}
+		l.buckets[key] = l.lru.PushFront(b)
+	}
+	b.lastSeen = now
+
+	result := RateLimitResult{Allowed: true, Limit: policy.Burst}
+	reservation := b.limiter.ReserveN(now, 1)
+	if !reservation.OK() {
+		result.Allowed = false
+		result.RetryAfter = time.Second
+	} else if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		result.Allowed = false
+		result.RetryAfter = delay
+	}
+
+	tokens := b.limiter.TokensAt(now)
+	if tokens > 0 {
+		result.Remaining = int(tokens)
+	}
+	if policy.Rate > 0 {
+		result.Reset = time.Duration((float64(policy.Burst) - tokens) / float64(policy.Rate) * float64(time.Second))
+	}
+	return result
+}
+
+// evict удаляет корзины с конца LRU-списка, пока их слишком много или они простаивают дольше IdleTTL.
+func (l *KeyedLimiter) evict(now time.Time) {
+	for element := l.lru.Back(); element != nil; element = l.lru.Back() {
+		b := element.Value.(*bucket)
+		if l.lru.Len() < l.config.MaxKeys && now.Sub(b.lastSeen) < l.config.IdleTTL {
+			return
+		}
+		l.lru.Remove(element)
+		delete(l.buckets, b.key)
+	}
+}
+
+// clientKey определяет, чей лимит расходует запрос: аутентифицированного
+// пользователя, API-ключа или IP-адреса клиента. Пользователь и API-ключ
+// получают свою корзину, только если они подтверждены: токен не отозван и его
+// сессия жива, а ключ есть в APIKeys. Иначе новый токен или ключ в каждом
+// запросе давал бы новую корзину и вытеснял из LRU корзины других клиентов.
+func clientKey(r *http.Request) string {
+	if authHeader := r.Header.Get("Authorization"); strings.HasPrefix(authHeader, "Bearer ") && Revocations != nil {
+		if claims, err := ParseToken(strings.TrimPrefix(authHeader, "Bearer ")); err == nil && claims.Subject != "" {
+			if revoked, err := Revocations.IsRevoked(r.Context(), claims); err == nil && !revoked {
+				return "user:" + claims.Subject
+			}
+		}
+	}
+	if apiKey := r.Header.Get("X-API-Key"); apiKey != "" && APIKeys != nil {
+		if keyHash := HashToken(apiKey); APIKeys.Valid(keyHash) {
+			return "key:" + keyHash
+		}
+	}
+	return "ip:" + ClientIP(r)
+}
+
+// ceilSeconds округляет длительность вверх до целых секунд, как требуют заголовки.
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int((d + time.Second - 1) / time.Second)
+}
+
+// RateLimit ограничивает частоту запросов клиента и сообщает состояние лимита
+// в заголовках RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset и Retry-After.
 func RateLimit(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !Limiter.Allow() {
+		route := routeTemplate(r)
+		name, policy := Limiter.Policy(route)
+		key := name + "|" + clientKey(r)
+
+		var result RateLimitResult
+		var err error
+		if SharedLimiter != nil {
+			result, err = SharedLimiter.Allow(r.Context(), key, policy)
+			if err != nil && !errors.Is(err, errStoreUnavailable) {
+				logging.FromContext(r.Context()).Warn("Shared rate limit store failed, falling back to local limiter", zap.Error(err))
+			}
+		}
+		// Без общего хранилища или при его недоступности лимит считается локально.
+		if SharedLimiter == nil || err != nil {
+			result = Limiter.Allow(key, policy)
+		}
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+		if !result.Allowed {
+			metrics.RateLimitRejections.WithLabelValues(route).Inc()
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
 			w.Header().Set("Content-Type", "application/json")
 			response := models.Response{Status: "fail", Message: "Too Many Requests"}
 			w.WriteHeader(http.StatusTooManyRequests)
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"ass3_part2/logging"
+	"ass3_part2/metrics"
+	"ass3_part2/models"
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"net/http"
+	"runtime/debug"
+)
+
+// Recovery перехватывает панику обработчика: логирует ее со стеком, увеличивает
+// счетчик и, если ответ еще не начат, возвращает 500 в формате Response.
+func Recovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := newResponseRecorder(w)
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			// ErrAbortHandler - штатный способ оборвать ответ, net/http обработает его сам.
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			metrics.PanicsRecovered.Inc()
+			logging.FromContext(r.Context()).Error("Panic in HTTP handler",
+				zap.String("panic", fmt.Sprint(recovered)),
+				zap.ByteString("stack", debug.Stack()),
+			)
+
+			if recorder.wroteHeader {
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(models.Response{Status: "fail", Message: "Internal Server Error"})
+		}()
+
+		next.ServeHTTP(recorder, r)
+	})
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"ass3_part2/logging"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID принимает идентификатор клиента, только если он короткий
+// и состоит из безопасных символов, чтобы его можно было писать в логи и заголовки.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// RequestID принимает X-Request-ID клиента или генерирует новый, сохраняет его
+// в контексте для logging.FromContext и возвращает в заголовке ответа.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			generated, err := GenerateRandomToken(16)
+			if err != nil {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			id = generated
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		ctx := logging.NewContext(r.Context(), &logging.RequestInfo{RequestID: id})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// routeTemplate возвращает шаблон совпавшего маршрута mux или путь запроса,
+// если маршрут неизвестен.
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return r.URL.Path
+}
+
+// RouteInfo дописывает в сведения о запросе шаблон совпавшего маршрута.
+func RouteInfo(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if info := logging.InfoFromContext(r.Context()); info != nil && mux.CurrentRoute(r) != nil {
+			info.Route = routeTemplate(r)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,167 @@
+package middleware
+
+import (
+	"ass3_part2/logging"
+	"ass3_part2/repository"
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+const (
+	// revocationCacheTTL ограничивает, как долго реплика может не замечать отзыв,
+	// сделанный на другой реплике.
+	revocationCacheTTL = 30 * time.Second
+	// lastSeenInterval - как часто обновляется last_seen_at активной сессии.
+	lastSeenInterval = time.Minute
+)
+
+type revocationEntry struct {
+	revoked   bool
+	expiresAt time.Time
+}
+
+// RevocationStore проверяет jti и сессии токенов по репозиториям, кешируя результаты в памяти.
+type RevocationStore struct {
+	sessions      repository.SessionRepository
+	revokedTokens repository.RevokedTokenRepository
+	mu            sync.Mutex
+	entries       map[string]revocationEntry
+	lastSeen      map[string]time.Time
+	// pending - отметки активности, еще не записанные в базу; их пишет
+	// одна фоновая горутина, пока flushing.
+	pending  map[string]sessionActivity
+	flushing bool
+}
+
+type sessionActivity struct {
+	seenAt time.Time
+	ip     string
+}
+
+func NewRevocationStore(repos repository.Repositories) *RevocationStore {
+	return &RevocationStore{
+		sessions:      repos.Sessions,
+		revokedTokens: repos.RevokedTokens,
+		entries:       make(map[string]revocationEntry),
+		lastSeen:      make(map[string]time.Time),
+		pending:       make(map[string]sessionActivity),
+	}
+}
+
+// Revocations используется MiddlewareAuth; создается в main.
+var Revocations *RevocationStore
+
+func (s *RevocationStore) cached(key string) (bool, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		delete(s.entries, key)
+		return false, false
+	}
+	return entry.revoked, true
+}
+
+func (s *RevocationStore) remember(key string, revoked bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = revocationEntry{revoked: revoked, expiresAt: time.Now().Add(revocationCacheTTL)}
+}
+
+// IsRevoked сообщает, отозван ли сам токен (по jti) или сессия, которой он выдан.
+// Токен без jti или sid сервис не выпускает, поэтому такой токен считается отозванным.
+func (s *RevocationStore) IsRevoked(ctx context.Context, claims *Claims) (bool, error) {
+	if claims.ID == "" || claims.SessionID == "" {
+		return true, nil
+	}
+
+	key := "jti:" + claims.ID
+	revoked, ok := s.cached(key)
+	if !ok {
+		var err error
+		if revoked, err = s.revokedTokens.IsRevoked(ctx, claims.ID); err != nil {
+			return false, err
+		}
+		s.remember(key, revoked)
+	}
+	if revoked {
+		return true, nil
+	}
+
+	key = "sid:" + claims.SessionID
+	revoked, ok = s.cached(key)
+	if !ok {
+		session, err := s.sessions.Get(ctx, claims.SessionID)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return false, err
+		}
+		revoked = err != nil || session.RevokedAt != nil
+		s.remember(key, revoked)
+	}
+	return revoked, nil
+}
+
+// RevokeToken заносит jti access-токена в список отзыва до истечения его срока.
+func (s *RevocationStore) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	if err := s.revokedTokens.Revoke(ctx, jti, expiresAt); err != nil {
+		return err
+	}
+	s.remember("jti:"+jti, true)
+	return nil
+}
+
+// ForgetSession сбрасывает закешированное состояние сессии после ее отзыва на этой реплике.
+func (s *RevocationStore) ForgetSession(sessionID string) {
+	s.remember("sid:"+sessionID, true)
+}
+
+// touch обновляет last_seen_at и IP сессии не чаще раза в lastSeenInterval.
+// Запросы не ждут записи: отметки копятся в pending, и их пишет одна фоновая
+// горутина, так что число одновременных записей не растет с нагрузкой.
+func (s *RevocationStore) touch(sessionID, ip string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	last, ok := s.lastSeen[sessionID]
+	now := time.Now()
+	if ok && now.Sub(last) < lastSeenInterval {
+		return
+	}
+	s.lastSeen[sessionID] = now
+	for id, seen := range s.lastSeen {
+		if now.Sub(seen) > revocationCacheTTL+lastSeenInterval {
+			delete(s.lastSeen, id)
+		}
+	}
+
+	s.pending[sessionID] = sessionActivity{seenAt: now, ip: ip}
+	if !s.flushing {
+		s.flushing = true
+		go s.flushActivity()
+	}
+}
+
+// flushActivity записывает накопленные отметки активности, пока они есть.
+func (s *RevocationStore) flushActivity() {
+	for {
+		s.mu.Lock()
+		if len(s.pending) == 0 {
+			s.flushing = false
+			s.mu.Unlock()
+			return
+		}
+		batch := s.pending
+		s.pending = make(map[string]sessionActivity)
+		s.mu.Unlock()
+
+		for sessionID, activity := range batch {
+			err := s.sessions.UpdateFields(context.Background(), sessionID,
+				map[string]interface{}{"last_seen_at": activity.seenAt, "ip": activity.ip})
+			if err != nil {
+				logging.Logger.Warn("Failed to update session activity", zap.String("session_id", sessionID), zap.Error(err))
+			}
+		}
+	}
+}
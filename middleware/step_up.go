@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"ass3_part2/models"
+	"ass3_part2/repository"
+	"ass3_part2/totp"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// StepUpMaxAge - сколько после ввода второго фактора действие считается подтвержденным.
+	StepUpMaxAge = 5 * time.Minute
+	// StepUpHeader - заголовок, в котором можно передать TOTP или код восстановления вместо повторного входа.
+	StepUpHeader = "X-TOTP-Code"
+)
+
+// ErrTOTPNotEnabled означает, что у пользователя не настроен второй фактор.
+var ErrTOTPNotEnabled = errors.New("two-factor authentication is not enabled")
+
+// hasRecentOTP сообщает, подтверждался ли второй фактор в сессии не раньше maxAge
+// назад. Проверяется строка сессии в базе, а не claims auth_time и amr токена.
+func hasRecentOTP(session models.Session, maxAge time.Duration) bool {
+	if time.Since(session.AuthTime) > maxAge {
+		return false
+	}
+	for _, method := range splitAMR(session.AMR) {
+		if method == "otp" {
+			return true
+		}
+	}
+	return false
+}
+
+// UserID возвращает идентификатор пользователя из claim sub.
+func (c *Claims) UserID() (int64, error) {
+	return strconv.ParseInt(c.Subject, 10, 64)
+}
+
+// NormalizeRecoveryCode приводит код восстановления к виду, в котором хранится его хеш.
+func NormalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// SecondFactorVerifier проверяет второй фактор: TOTP-секрет и коды восстановления.
+type SecondFactorVerifier struct {
+	secondFactors repository.SecondFactorRepository
+	sessions      repository.SessionRepository
+	tx            repository.Transactor
+}
+
+func NewSecondFactorVerifier(repos repository.Repositories) *SecondFactorVerifier {
+	return &SecondFactorVerifier{secondFactors: repos.SecondFactors, sessions: repos.Sessions, tx: repos.Tx}
+}
+
+// Verify проверяет TOTP-код или одноразовый код восстановления пользователя.
+// Использованный код погашается и повторно не принимается.
+func (v *SecondFactorVerifier) Verify(ctx context.Context, userID int64, code string) (bool, error) {
+	valid := false
+	err := v.tx.InTx(ctx, func(ctx context.Context) error {
+		userTOTP, err := v.secondFactors.GetTOTP(ctx, userID)
+		if errors.Is(err, repository.ErrNotFound) || err == nil && !userTOTP.Enabled {
+			return ErrTOTPNotEnabled
+		}
+		if err != nil {
+			return err
+		}
+
+		secret, err := totp.DecryptSecret(userTOTP.SecretEncrypted)
+		if err != nil {
+			return err
+		}
+		if step, ok := totp.Validate(secret, code, time.Now(), userTOTP.LastUsedStep); ok {
+			valid = true
+			return v.secondFactors.UpdateTOTP(ctx, userID, map[string]interface{}{"last_used_step": step})
+		}
+
+		valid, err = v.secondFactors.UseRecoveryCode(ctx, userID, HashToken(NormalizeRecoveryCode(code)))
+		return err
+	})
+	return valid, err
+}
+
+// RequireStepUp пропускает запрос, только если второй фактор недавно подтвержден
+// в сессии токена (auth_time и amr ее строки в базе) или валидный код передан в
+// заголовке X-TOTP-Code. Должен стоять после MiddlewareAuth.
+func (v *SecondFactorVerifier) RequireStepUp(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := ClaimsFromContext(r.Context())
+		if !ok || claims.SessionID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		userID, err := claims.UserID()
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		session, err := v.sessions.Get(r.Context(), claims.SessionID)
+		if errors.Is(err, repository.ErrNotFound) || err == nil && (session.UserID != userID || session.RevokedAt != nil) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if hasRecentOTP(session, StepUpMaxAge) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		code := r.Header.Get(StepUpHeader)
+		if code == "" {
+			http.Error(w, "Step-up authentication required", http.StatusUnauthorized)
+			return
+		}
+		valid, err := v.Verify(r.Context(), userID, code)
+		if errors.Is(err, ErrTOTPNotEnabled) {
+			http.Error(w, "Forbidden: two-factor authentication must be enabled", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !valid {
+			http.Error(w, "Step-up authentication failed", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
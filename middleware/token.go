@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"ass3_part2/models"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/golang-jwt/jwt/v4"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// GenerateAccessToken выпускает короткоживущий access-токен пользователя для указанной сессии.
+// auth_time и amr берутся из сессии, поэтому переживают обновление токенов.
+func GenerateAccessToken(user models.User, session models.Session) (string, time.Time, error) {
+	if len(JwtKey) == 0 {
+		return "", time.Time{}, ErrNoJWTKey
+	}
+	jti, err := GenerateRandomToken(16)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(AccessTokenTTL)
+	claims := &Claims{
+		Email:     user.Email,
+		SessionID: session.ID,
+		AuthTime:  jwt.NewNumericDate(session.AuthTime),
+		AMR:       splitAMR(session.AMR),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Subject:   strconv.FormatInt(user.ID, 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(JwtKey)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
+}
+
+func splitAMR(amr string) []string {
+	if amr == "" {
+		return nil
+	}
+	return strings.Split(amr, ",")
+}
+
+// GenerateRandomToken возвращает криптографически случайную строку из n байт в hex.
+func GenerateRandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// HashToken возвращает SHA-256 хеш непрозрачного токена; в БД хранятся только хеши.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,13 +1,26 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"ass3_part2/money"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Статусы тарифа. Архивный тариф скрыт из каталога и недоступен для покупки,
+// но подписки и транзакции по нему сохраняются.
+const (
+	PlanStatusActive   = "active"
+	PlanStatusArchived = "archived"
+)
 
 type PremiumSubscription struct {
 	ID        uint           `json:"id" gorm:"primaryKey;autoIncrement"`
 	Plan      string         `json:"plan" gorm:"type:varchar(100);not null"`
 	Period    uint           `json:"period" gorm:"not null"`
+	Price     money.Money    `json:"price" gorm:"embedded;embeddedPrefix:price_"` // Цена за период в минимальных единицах валюты
 	Status    string         `json:"status" gorm:"type:varchar(50);default:'active'"`
-	CreatedAt string         `json:"created_at"`
-	UpdatedAt string         `json:"updated_at"`
+	Version   int64          `json:"version" gorm:"not null;default:1"` // Растет при каждом изменении; отдается как ETag
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"deleted_at" gorm:"index"`
 }
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// RateLimitCounter - счетчик запросов ключа в одном окне общего для всех реплик лимита.
+type RateLimitCounter struct {
+	Key         string    `gorm:"primaryKey;type:varchar(255)"`
+	WindowIndex int64     `gorm:"primaryKey;autoIncrement:false"` // номер окна от начала эпохи
+	Count       int64     `gorm:"not null"`
+	ExpiresAt   time.Time `gorm:"not null;index"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// RefreshToken хранит хеш refresh-токена. UsedAt выставляется при ротации:
+// повторное предъявление использованного токена означает его кражу.
+type RefreshToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	SessionID string     `json:"session_id" gorm:"type:varchar(64);not null;index"`
+	UserID    int64      `json:"user_id" gorm:"not null"`
+	TokenHash string     `json:"-" gorm:"type:varchar(64);uniqueIndex;not null"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// RevokedToken - отозванный до истечения срока access-токен (по claim jti).
+// Запись нужна только до ExpiresAt: после него токен отклоняется и так.
+type RevokedToken struct {
+	JTI       string    `json:"jti" gorm:"primaryKey;type:varchar(64)"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null;index"`
+	CreatedAt time.Time `json:"created_at"`
+}
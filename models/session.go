@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Session объединяет цепочку refresh-токенов, выданных при одном входе пользователя.
+type Session struct {
+	ID         string     `json:"id" gorm:"primaryKey;type:varchar(64)"`
+	UserID     int64      `json:"user_id" gorm:"not null;index"`
+	UserAgent  string     `json:"user_agent" gorm:"type:varchar(255)"`
+	IP         string     `json:"ip" gorm:"type:varchar(64)"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	AuthTime   time.Time  `json:"auth_time"`                   // время последней проверки учетных данных
+	AMR        string     `json:"amr" gorm:"type:varchar(64)"` // методы аутентификации через запятую: pwd, otp
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"not null"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
@@ -1,12 +1,21 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"ass3_part2/money"
+	"gorm.io/gorm"
+	"time"
+)
 
+// Transaction - платежная транзакция. Через API она не изменяется, поэтому
+// ETag/If-Match для нее нет; Version защищает смену статуса при оплате
+// (paid -> completed) от одновременной записи другим процессом.
 type Transaction struct {
 	ID             uint           `json:"id" gorm:"primaryKey;autoIncrement"`
 	SubscriptionID uint           `json:"subscription_id" gorm:"not null"`                  // Внешний ключ
+	Amount         money.Money    `json:"amount" gorm:"embedded"`                           // Списанная сумма: колонки amount и currency
 	Status         string         `json:"status" gorm:"type:varchar(50);default:'pending'"` // pending, paid, declined
-	CreatedAt      string         `json:"created_at"`
-	UpdatedAt      string         `json:"updated_at"`
+	Version        int64          `json:"version" gorm:"not null;default:1"`                // Версия для оптимистичной блокировки (TransactionRepository.Update)
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
 	DeletedAt      gorm.DeletedAt `json:"deleted_at" gorm:"index"`
 }
@@ -1,14 +1,19 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"gorm.io/gorm"
+	"time"
+)
 
+// UserSubscription - оформленная подписка. После создания не изменяется,
+// поэтому версии у нее нет.
 type UserSubscription struct {
 	ID             uint           `json:"id" gorm:"primaryKey;autoIncrement"`
 	UserID         uint           `json:"user_id" gorm:"not null"`
 	SubscriptionID uint           `json:"subscription_id" gorm:"not null"`
-	StartDate      string         `json:"start_date" gorm:"type:date;not null"` // Дата начала подписки
-	EndDate        string         `json:"end_date" gorm:"type:date;not null"`
-	CreatedAt      string         `json:"created_at"`
-	UpdatedAt      string         `json:"updated_at"`
+	StartDate      time.Time      `json:"start_date" gorm:"not null"` // Начало подписки (UTC)
+	EndDate        time.Time      `json:"end_date" gorm:"not null;index"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
 	DeletedAt      gorm.DeletedAt `json:"deleted_at" gorm:"index"`
 }
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// UserTOTP - TOTP-секрет пользователя. Секрет хранится зашифрованным;
+// LastUsedStep защищает от повторного использования одного и того же кода.
+type UserTOTP struct {
+	UserID          int64      `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	SecretEncrypted string     `json:"-" gorm:"not null"`
+	Enabled         bool       `json:"enabled" gorm:"not null;default:false"`
+	LastUsedStep    int64      `json:"-"`
+	ConfirmedAt     *time.Time `json:"confirmed_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// RecoveryCode - одноразовый код восстановления на случай потери устройства с TOTP.
+type RecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID    int64      `json:"user_id" gorm:"not null;index"`
+	CodeHash  string     `json:"-" gorm:"type:varchar(64);not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
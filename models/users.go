@@ -4,14 +4,18 @@ import (
 	"time"
 )
 
+// User - учетная запись. Имя и email хранятся зашифрованными (encryption);
+// платежные данные карт не сохраняются вовсе.
 type User struct {
-	ID                int64     `gorm:"primaryKey;autoIncrement" json:"id"`
-	Name              string    `gorm:"not null" json:"name"`
-	Email             string    `gorm:"unique;not null" json:"email"`
-	RoleID            uint      `json:"role_id"`
-	Password          string    `gorm:"not null" json:"password"`
-	IsConfirmed       bool      `json:"-"`
-	ConfirmationToken *string   `json:"-"`
-	CreatedAt         time.Time `json:"created_at"`
-	UpdatedAt         time.Time `json:"updated_at"`
+	ID                 int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name               string     `gorm:"not null;serializer:encrypted" json:"name"`
+	Email              string     `gorm:"not null;serializer:encrypted" json:"email"`
+	EmailIndex         *string    `gorm:"uniqueIndex" json:"-"` // blind index email для поиска и уникальности
+	RoleID             uint       `json:"role_id"`
+	Password           string     `gorm:"not null" json:"-"`
+	IsConfirmed        bool       `json:"-"`
+	ConfirmationToken  *string    `json:"-"` // SHA-256 хеш токена из ссылки подтверждения
+	ConfirmationSentAt *time.Time `json:"-"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
 }
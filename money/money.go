@@ -0,0 +1,281 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+var (
+	ErrUnknownCurrency  = errors.New("unknown currency")
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	ErrOverflow         = errors.New("amount overflows int64")
+	ErrInvalidAmount    = errors.New("invalid amount")
+)
+
+// exponents - число знаков после запятой (ISO 4217) у поддерживаемых валют.
+var exponents = map[string]int{
+	"KZT": 2,
+	"RUB": 2,
+	"USD": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"JPY": 0,
+	"KRW": 0,
+	"BHD": 3,
+	"KWD": 3,
+	"OMR": 3,
+}
+
+// Exponent возвращает число знаков дробной части валюты.
+func Exponent(currency string) (int, error) {
+	exponent, ok := exponents[currency]
+	if !ok {
+		return 0, fmt.Errorf("%w %q", ErrUnknownCurrency, currency)
+	}
+	return exponent, nil
+}
+
+// Money - сумма в минимальных единицах валюты (тиынах, центах, филсах).
+// Хранится в двух колонках: сумма и код валюты ISO 4217.
+type Money struct {
+	Amount   int64  `gorm:"not null"`
+	Currency string `gorm:"type:varchar(3);not null"`
+}
+
+// New создает сумму из минимальных единиц, проверяя код валюты.
+func New(amount int64, currency string) (Money, error) {
+	if _, err := Exponent(currency); err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// Parse разбирает десятичную запись ("1234.50") с учетом экспоненты валюты.
+// Знаков после точки не может быть больше, чем у валюты.
+func Parse(value, currency string) (Money, error) {
+	exponent, err := Exponent(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	value = strings.TrimSpace(value)
+	negative := strings.HasPrefix(value, "-")
+	value = strings.TrimPrefix(value, "-")
+
+	whole, fraction, _ := strings.Cut(value, ".")
+	if whole == "" || len(fraction) > exponent || strings.Contains(value, ".") && fraction == "" {
+		return Money{}, fmt.Errorf("%w %q for %s", ErrInvalidAmount, value, currency)
+	}
+	digits := whole + fraction + strings.Repeat("0", exponent-len(fraction))
+	amount := new(big.Int)
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return Money{}, fmt.Errorf("%w %q for %s", ErrInvalidAmount, value, currency)
+		}
+	}
+	amount.SetString(digits, 10)
+	if negative {
+		amount.Neg(amount)
+	}
+	if !amount.IsInt64() {
+		return Money{}, ErrOverflow
+	}
+	return Money{Amount: amount.Int64(), Currency: currency}, nil
+}
+
+// IsZero сообщает, равна ли сумма нулю.
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// Validate проверяет код валюты и неотрицательность суммы.
+func (m Money) Validate() error {
+	if _, err := Exponent(m.Currency); err != nil {
+		return err
+	}
+	if m.Amount < 0 {
+		return fmt.Errorf("%w: negative amount", ErrInvalidAmount)
+	}
+	return nil
+}
+
+func (m Money) sameCurrency(other Money) error {
+	if m.Currency != other.Currency {
+		return fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	return nil
+}
+
+// Add складывает суммы одной валюты.
+func (m Money) Add(other Money) (Money, error) {
+	if err := m.sameCurrency(other); err != nil {
+		return Money{}, err
+	}
+	sum := m.Amount + other.Amount
+	if (other.Amount > 0 && sum < m.Amount) || (other.Amount < 0 && sum > m.Amount) {
+		return Money{}, ErrOverflow
+	}
+	return Money{Amount: sum, Currency: m.Currency}, nil
+}
+
+// Sub вычитает сумму той же валюты.
+func (m Money) Sub(other Money) (Money, error) {
+	if other.Amount == math.MinInt64 {
+		return Money{}, ErrOverflow
+	}
+	return m.Add(Money{Amount: -other.Amount, Currency: other.Currency})
+}
+
+// Mul умножает сумму на целое количество (например, число единиц товара).
+func (m Money) Mul(quantity int64) (Money, error) {
+	product := new(big.Int).Mul(big.NewInt(m.Amount), big.NewInt(quantity))
+	if !product.IsInt64() {
+		return Money{}, ErrOverflow
+	}
+	return Money{Amount: product.Int64(), Currency: m.Currency}, nil
+}
+
+// Percentage возвращает долю суммы в базисных пунктах (1250 = 12.5%),
+// округленную до минимальной единицы по банковскому правилу.
+func (m Money) Percentage(basisPoints int64) (Money, error) {
+	return m.mulRat(big.NewRat(basisPoints, 10000))
+}
+
+// mulRat умножает сумму на дробь с банковским округлением (half to even).
+func (m Money) mulRat(factor *big.Rat) (Money, error) {
+	product := new(big.Rat).Mul(new(big.Rat).SetInt64(m.Amount), factor)
+	rounded := roundHalfEven(product)
+	if !rounded.IsInt64() {
+		return Money{}, ErrOverflow
+	}
+	return Money{Amount: rounded.Int64(), Currency: m.Currency}, nil
+}
+
+// roundHalfEven округляет дробь до целого; ровно половина округляется к четному.
+func roundHalfEven(value *big.Rat) *big.Int {
+	quotient, remainder := new(big.Int).QuoRem(value.Num(), value.Denom(), new(big.Int))
+	if remainder.Sign() == 0 {
+		return quotient
+	}
+	// Сравниваем 2*|остаток| со знаменателем: больше - от нуля, меньше - к нулю.
+	doubled := new(big.Int).Abs(remainder)
+	doubled.Lsh(doubled, 1)
+	cmp := doubled.Cmp(value.Denom())
+	if cmp > 0 || (cmp == 0 && quotient.Bit(0) == 1) {
+		if value.Sign() < 0 {
+			quotient.Sub(quotient, big.NewInt(1))
+		} else {
+			quotient.Add(quotient, big.NewInt(1))
+		}
+	}
+	return quotient
+}
+
+// Allocate делит сумму пропорционально ratios без потери минимальных единиц:
+// остаток от деления раздается по одной единице первым получателям.
+func (m Money) Allocate(ratios ...int64) ([]Money, error) {
+	total := new(big.Int)
+	for _, ratio := range ratios {
+		if ratio < 0 {
+			return nil, fmt.Errorf("%w: negative ratio", ErrInvalidAmount)
+		}
+		total.Add(total, big.NewInt(ratio))
+	}
+	if total.Sign() == 0 {
+		return nil, fmt.Errorf("%w: ratios sum to zero", ErrInvalidAmount)
+	}
+
+	parts := make([]Money, len(ratios))
+	remainder := m.Amount
+	for i, ratio := range ratios {
+		share := new(big.Int).Mul(big.NewInt(m.Amount), big.NewInt(ratio))
+		share.Quo(share, total)
+		parts[i] = Money{Amount: share.Int64(), Currency: m.Currency}
+		remainder -= share.Int64()
+	}
+	step := int64(1)
+	if remainder < 0 {
+		step = -1
+	}
+	for i := 0; remainder != 0; i = (i + 1) % len(parts) {
+		if ratios[i] == 0 {
+			continue
+		}
+		parts[i].Amount += step
+		remainder -= step
+	}
+	return parts, nil
+}
+
+// Decimal возвращает сумму в десятичной записи с числом знаков валюты ("1234.50").
+func (m Money) Decimal() string {
+	exponent, err := Exponent(m.Currency)
+	if err != nil {
+		exponent = 0
+	}
+	sign := ""
+	amount := new(big.Int).SetInt64(m.Amount)
+	if amount.Sign() < 0 {
+		sign = "-"
+		amount.Neg(amount)
+	}
+	digits := amount.String()
+	if exponent == 0 {
+		return sign + digits
+	}
+	if len(digits) <= exponent {
+		digits = strings.Repeat("0", exponent-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-exponent] + "." + digits[len(digits)-exponent:]
+}
+
+// String возвращает сумму вместе с кодом валюты: "1234.50 KZT".
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+// jsonMoney - представление в API: десятичная строка и минимальные единицы,
+// чтобы клиентам не приходилось работать с float.
+type jsonMoney struct {
+	Amount      *string `json:"amount,omitempty"`
+	AmountMinor *int64  `json:"amount_minor,omitempty"`
+	Currency    string  `json:"currency"`
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	amount := m.Decimal()
+	return json.Marshal(jsonMoney{Amount: &amount, AmountMinor: &m.Amount, Currency: m.Currency})
+}
+
+// UnmarshalJSON принимает {"amount": "12.50", "currency": "KZT"} или
+// {"amount_minor": 1250, "currency": "KZT"}; при обоих полях они должны совпадать.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var value jsonMoney
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	if _, err := Exponent(value.Currency); err != nil {
+		return err
+	}
+
+	var parsed Money
+	switch {
+	case value.Amount != nil:
+		var err error
+		if parsed, err = Parse(*value.Amount, value.Currency); err != nil {
+			return err
+		}
+		if value.AmountMinor != nil && *value.AmountMinor != parsed.Amount {
+			return fmt.Errorf("%w: amount and amount_minor differ", ErrInvalidAmount)
+		}
+	case value.AmountMinor != nil:
+		parsed = Money{Amount: *value.AmountMinor, Currency: value.Currency}
+	default:
+		return fmt.Errorf("%w: amount is required", ErrInvalidAmount)
+	}
+	*m = parsed
+	return nil
+}
@@ -0,0 +1,194 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestPercentageRoundsHalfToEven(t *testing.T) {
+	tests := []struct {
+		amount      int64
+		basisPoints int64
+		want        int64
+	}{
+		{50, 100, 0},        // 0.5 -> 0
+		{150, 100, 2},       // 1.5 -> 2
+		{250, 100, 2},       // 2.5 -> 2
+		{350, 100, 4},       // 3.5 -> 4
+		{-150, 100, -2},     // -1.5 -> -2
+		{-250, 100, -2},     // -2.5 -> -2
+		{-350, 100, -4},     // -3.5 -> -4
+		{1234, 1250, 154},   // 154.25
+		{1238, 1250, 155},   // 154.75
+		{12345, 1250, 1543}, // 1543.125
+		{99900, 0, 0},
+		{99900, 10000, 99900},
+	}
+	for _, tt := range tests {
+		got, err := Money{Amount: tt.amount, Currency: "KZT"}.Percentage(tt.basisPoints)
+		if err != nil {
+			t.Fatalf("%d * %d bp: %v", tt.amount, tt.basisPoints, err)
+		}
+		if got.Amount != tt.want || got.Currency != "KZT" {
+			t.Errorf("%d * %d bp = %v, want %d KZT", tt.amount, tt.basisPoints, got, tt.want)
+		}
+	}
+}
+
+func TestAllocateSumsToTotal(t *testing.T) {
+	tests := []struct {
+		amount int64
+		ratios []int64
+		want   []int64
+	}{
+		{100, []int64{1, 1, 1}, []int64{34, 33, 33}},
+		{-100, []int64{1, 1, 1}, []int64{-34, -33, -33}},
+		{101, []int64{1, 0, 1}, []int64{51, 0, 50}},
+		{5, []int64{70, 30}, []int64{4, 1}},
+		{1, []int64{1, 1, 1, 1}, []int64{1, 0, 0, 0}},
+		{0, []int64{1, 2}, []int64{0, 0}},
+		{99999, []int64{3, 3, 3}, []int64{33333, 33333, 33333}},
+	}
+	for _, tt := range tests {
+		parts, err := Money{Amount: tt.amount, Currency: "USD"}.Allocate(tt.ratios...)
+		if err != nil {
+			t.Fatalf("allocate %d by %v: %v", tt.amount, tt.ratios, err)
+		}
+		var sum int64
+		for i, part := range parts {
+			sum += part.Amount
+			if part.Amount != tt.want[i] || part.Currency != "USD" {
+				t.Errorf("allocate %d by %v: part %d = %v, want %d USD", tt.amount, tt.ratios, i, part, tt.want[i])
+			}
+		}
+		if sum != tt.amount {
+			t.Errorf("allocate %d by %v: parts sum to %d", tt.amount, tt.ratios, sum)
+		}
+	}
+}
+
+func TestAllocateRejectsInvalidRatios(t *testing.T) {
+	for _, ratios := range [][]int64{nil, {0, 0}, {1, -1}} {
+		if _, err := (Money{Amount: 100, Currency: "USD"}).Allocate(ratios...); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("allocate by %v: err = %v, want ErrInvalidAmount", ratios, err)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value    string
+		currency string
+		want     int64
+		err      error
+	}{
+		{"1234.50", "KZT", 123450, nil},
+		{"1234.5", "KZT", 123450, nil},
+		{"1234", "KZT", 123400, nil},
+		{" 0.05 ", "KZT", 5, nil},
+		{"-12.34", "KZT", -1234, nil},
+		{"1.234", "BHD", 1234, nil},
+		{"500", "JPY", 500, nil},
+		{"12.345", "KZT", 0, ErrInvalidAmount},
+		{"1.5", "JPY", 0, ErrInvalidAmount},
+		{"1.2345", "BHD", 0, ErrInvalidAmount},
+		{"12.", "KZT", 0, ErrInvalidAmount},
+		{".5", "KZT", 0, ErrInvalidAmount},
+		{"1e3", "KZT", 0, ErrInvalidAmount},
+		{"", "KZT", 0, ErrInvalidAmount},
+		{"92233720368547758.08", "KZT", 0, ErrOverflow},
+		{"1.00", "XXX", 0, ErrUnknownCurrency},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.value, tt.currency)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Parse(%q, %s): err = %v, want %v", tt.value, tt.currency, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got.Amount != tt.want || got.Currency != tt.currency {
+			t.Errorf("Parse(%q, %s) = %v, %v; want %d", tt.value, tt.currency, got, err, tt.want)
+		}
+	}
+}
+
+func TestAddSub(t *testing.T) {
+	a := Money{Amount: 1050, Currency: "KZT"}
+	b := Money{Amount: -2000, Currency: "KZT"}
+	if sum, err := a.Add(b); err != nil || sum.Amount != -950 {
+		t.Errorf("Add = %v, %v; want -950", sum, err)
+	}
+	if diff, err := a.Sub(b); err != nil || diff.Amount != 3050 {
+		t.Errorf("Sub = %v, %v; want 3050", diff, err)
+	}
+
+	usd := Money{Amount: 1, Currency: "USD"}
+	if _, err := a.Add(usd); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Add across currencies: err = %v, want ErrCurrencyMismatch", err)
+	}
+	if _, err := a.Sub(usd); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Sub across currencies: err = %v, want ErrCurrencyMismatch", err)
+	}
+
+	maxAmount := Money{Amount: 1<<63 - 1, Currency: "KZT"}
+	if _, err := maxAmount.Add(Money{Amount: 1, Currency: "KZT"}); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Add overflow: err = %v, want ErrOverflow", err)
+	}
+	if _, err := a.Sub(Money{Amount: -1 << 63, Currency: "KZT"}); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Sub of MinInt64: err = %v, want ErrOverflow", err)
+	}
+}
+
+func TestValidateRejectsNegative(t *testing.T) {
+	if err := (Money{Amount: -1, Currency: "KZT"}).Validate(); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("Validate negative: err = %v, want ErrInvalidAmount", err)
+	}
+	if err := (Money{Amount: 0, Currency: "KZT"}).Validate(); err != nil {
+		t.Errorf("Validate zero: %v", err)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	tests := []struct {
+		money Money
+		json  string
+	}{
+		{Money{Amount: 123450, Currency: "KZT"}, `{"amount":"1234.50","amount_minor":123450,"currency":"KZT"}`},
+		{Money{Amount: 5, Currency: "KZT"}, `{"amount":"0.05","amount_minor":5,"currency":"KZT"}`},
+		{Money{Amount: -1250, Currency: "USD"}, `{"amount":"-12.50","amount_minor":-1250,"currency":"USD"}`},
+		{Money{Amount: 1234, Currency: "BHD"}, `{"amount":"1.234","amount_minor":1234,"currency":"BHD"}`},
+		{Money{Amount: 500, Currency: "JPY"}, `{"amount":"500","amount_minor":500,"currency":"JPY"}`},
+	}
+	for _, tt := range tests {
+		encoded, err := json.Marshal(tt.money)
+		if err != nil || string(encoded) != tt.json {
+			t.Errorf("Marshal(%v) = %s, %v; want %s", tt.money, encoded, err, tt.json)
+			continue
+		}
+		var decoded Money
+		if err := json.Unmarshal(encoded, &decoded); err != nil || decoded != tt.money {
+			t.Errorf("Unmarshal(%s) = %v, %v; want %v", encoded, decoded, err, tt.money)
+		}
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	var m Money
+	if err := json.Unmarshal([]byte(`{"amount_minor":1250,"currency":"KZT"}`), &m); err != nil || m.Amount != 1250 {
+		t.Errorf("amount_minor only: %v, %v", m, err)
+	}
+	invalid := []string{
+		`{"amount":"12.50","amount_minor":1251,"currency":"KZT"}`,
+		`{"amount":"12.505","currency":"KZT"}`,
+		`{"currency":"KZT"}`,
+		`{"amount":"12.50","currency":"XXX"}`,
+		`{"amount":12.5,"currency":"KZT"}`,
+	}
+	for _, data := range invalid {
+		if err := json.Unmarshal([]byte(data), &m); err == nil {
+			t.Errorf("Unmarshal(%s): expected error", data)
+		}
+	}
+}
@@ -0,0 +1,447 @@
+package repository
+
+import (
+	"ass3_part2/encryption"
+	"ass3_part2/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// SQLSTATE ошибок Postgres, после которых транзакцию можно повторить.
+const (
+	pgSerializationFailure = "40001"
+	pgDeadlockDetected     = "40P01"
+)
+
+// maxTxAttempts ограничивает число попыток транзакции при конфликтах сериализации.
+const maxTxAttempts = 5
+
+type txKey struct{}
+
+// WithTx возвращает контекст, в котором GORM-репозитории работают внутри транзакции tx.
+// Так изменения через репозитории и прямые запросы к tx фиксируются вместе.
+func WithTx(ctx context.Context, tx *gorm.DB) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
+
+// ReadRouter выбирает соединение для запросов только на чтение (см. db.ReplicaSet).
+type ReadRouter interface {
+	Reader(ctx context.Context) *gorm.DB
+}
+
+// NewGormRepositories создает репозитории поверх соединения GORM.
+func NewGormRepositories(db *gorm.DB) Repositories {
+	return NewGormRepositoriesWithReplicas(db, nil)
+}
+
+// NewGormRepositoriesWithReplicas создает репозитории, которые выполняют
+// выборки списков через reads, а все остальное - через primary db.
+func NewGormRepositoriesWithReplicas(db *gorm.DB, reads ReadRouter) Repositories {
+	base := gormRepository{db: db, reads: reads}
+	return Repositories{
+		Plans:             gormPlans{base},
+		UserSubscriptions: gormUserSubscriptions{base},
+		Transactions:      gormTransactions{base},
+		Users:             gormUsers{base},
+		Sessions:          gormSessions{base},
+		RefreshTokens:     gormRefreshTokens{base},
+		PasswordResets:    gormPasswordResets{base},
+		SecondFactors:     gormSecondFactors{base},
+		RevokedTokens:     gormRevokedTokens{base},
+		Tx:                gormTransactor{base},
+	}
+}
+
+type gormRepository struct {
+	db    *gorm.DB
+	reads ReadRouter
+}
+
+// conn возвращает транзакцию из контекста или общее соединение.
+func (r gormRepository) conn(ctx context.Context) *gorm.DB {
+	if tx, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return tx.WithContext(ctx)
+	}
+	return r.db.WithContext(ctx)
+}
+
+// readConn - соединение для выборок, которым допустимо небольшое отставание:
+// реплика, если она есть. Внутри транзакции читаем из нее же.
+func (r gormRepository) readConn(ctx context.Context) *gorm.DB {
+	if tx, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return tx.WithContext(ctx)
+	}
+	if r.reads != nil {
+		return r.reads.Reader(ctx)
+	}
+	return r.db.WithContext(ctx)
+}
+
+// lockingConn - соединение, блокирующее выбранные строки до конца транзакции
+// (SELECT ... FOR UPDATE). Вне транзакции блокировать нечего; SQLite блокирует
+// базу целиком, и GORM для него предложение не добавляет.
+func (r gormRepository) lockingConn(ctx context.Context) *gorm.DB {
+	if tx, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return tx.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+	return r.db.WithContext(ctx)
+}
+
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// versionMismatch выясняет, почему обновление с условием на версию не затронуло
+// строк: записи нет (ErrNotFound) или ее версия уже другая (ErrVersionConflict).
+func versionMismatch(tx *gorm.DB, model interface{}, id uint) error {
+	var count int64
+	if err := tx.Model(model).Where("id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return ErrVersionConflict
+}
+
+// withVersion добавляет условие на версию, если она задана.
+func withVersion(tx *gorm.DB, version int64) *gorm.DB {
+	if version == 0 {
+		return tx
+	}
+	return tx.Where("version = ?", version)
+}
+
+// inUse переводит нарушение внешнего ключа в ErrInUse. Ошибки драйверов
+// приводятся к gorm.ErrForeignKeyViolated настройкой TranslateError (см. db.NewDb).
+func inUse(err error) error {
+	if errors.Is(err, gorm.ErrForeignKeyViolated) {
+		return ErrInUse
+	}
+	return err
+}
+
+type gormTransactor struct{ gormRepository }
+
+func (r gormTransactor) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return fn(ctx)
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := setStatementTimeout(ctx, tx); err != nil {
+			return err
+		}
+		return fn(WithTx(ctx, tx))
+	})
+}
+
+func (r gormTransactor) InSerializableTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	// Внутри уже открытой транзакции повторять нечего - ее откатит и повторит владелец.
+	if _, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return fn(ctx)
+	}
+
+	backoff := 10 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := setStatementTimeout(ctx, tx); err != nil {
+				return err
+			}
+			return fn(WithTx(ctx, tx))
+		}, &sql.TxOptions{Isolation: sql.LevelSerializable})
+		if err == nil || !retryableTxError(err) || attempt == maxTxAttempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff + time.Duration(rand.Int63n(int64(backoff)))):
+		}
+		backoff *= 2
+	}
+}
+
+// retryableTxError сообщает, можно ли повторить транзакцию целиком.
+func retryableTxError(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && (pgErr.Code == pgSerializationFailure || pgErr.Code == pgDeadlockDetected)
+}
+
+// setStatementTimeout ограничивает запросы транзакции оставшимся временем
+// контекста, чтобы сервер не продолжал их после ответа клиенту. В SQLite
+// statement_timeout нет - там запрос прерывается отменой контекста.
+func setStatementTimeout(ctx context.Context, tx *gorm.DB) error {
+	deadline, ok := ctx.Deadline()
+	if !ok || tx.Dialector.Name() != "postgres" {
+		return nil
+	}
+	remaining := time.Until(deadline).Milliseconds()
+	if remaining <= 0 {
+		return context.DeadlineExceeded
+	}
+	return tx.Exec(fmt.Sprintf("SET LOCAL statement_timeout = %d", remaining)).Error
+}
+
+type gormPlans struct{ gormRepository }
+
+func (r gormPlans) List(ctx context.Context) ([]models.PremiumSubscription, error) {
+	var plans []models.PremiumSubscription
+	err := r.readConn(ctx).Where("status IS NULL OR status <> ?", models.PlanStatusArchived).Find(&plans).Error
+	return plans, err
+}
+
+func (r gormPlans) Get(ctx context.Context, id uint) (models.PremiumSubscription, error) {
+	var plan models.PremiumSubscription
+	err := r.conn(ctx).First(&plan, id).Error
+	return plan, notFound(err)
+}
+
+func (r gormPlans) Create(ctx context.Context, plan *models.PremiumSubscription) error {
+	plan.Version = 1
+	return r.conn(ctx).Create(plan).Error
+}
+
+func (r gormPlans) Update(ctx context.Context, plan *models.PremiumSubscription) error {
+	conn := r.conn(ctx)
+	result := conn.Model(&models.PremiumSubscription{}).
+		Where("id = ? AND version = ?", plan.ID, plan.Version).
+		Updates(map[string]interface{}{
+			"plan":           plan.Plan,
+			"period":         plan.Period,
+			"price_amount":   plan.Price.Amount,
+			"price_currency": plan.Price.Currency,
+			"version":        gorm.Expr("version + 1"),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return versionMismatch(conn, &models.PremiumSubscription{}, plan.ID)
+	}
+	return notFound(conn.First(plan, plan.ID).Error)
+}
+
+func (r gormPlans) Archive(ctx context.Context, id uint, version int64) error {
+	conn := r.conn(ctx)
+	result := withVersion(conn.Model(&models.PremiumSubscription{}).Where("id = ?", id), version).
+		Updates(map[string]interface{}{
+			"status":  models.PlanStatusArchived,
+			"version": gorm.Expr("version + 1"),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return versionMismatch(conn, &models.PremiumSubscription{}, id)
+	}
+	return nil
+}
+
+func (r gormPlans) Delete(ctx context.Context, id uint, version int64) error {
+	return r.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		// Внешние ключи и так не дадут удалить тариф с историей; проверка заранее
+		// учитывает и мягко удаленные записи и дает понятную ошибку.
+		for _, model := range []interface{}{&models.UserSubscription{}, &models.Transaction{}} {
+			var count int64
+			if err := tx.Unscoped().Model(model).Where("subscription_id = ?", id).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return ErrInUse
+			}
+		}
+		result := withVersion(tx.Unscoped().Where("id = ?", id), version).Delete(&models.PremiumSubscription{})
+		if result.Error != nil {
+			return inUse(result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return versionMismatch(tx, &models.PremiumSubscription{}, id)
+		}
+		return nil
+	})
+}
+
+type gormUserSubscriptions struct{ gormRepository }
+
+func (r gormUserSubscriptions) Create(ctx context.Context, subscription *models.UserSubscription) error {
+	return r.conn(ctx).Create(subscription).Error
+}
+
+func (r gormUserSubscriptions) ListByUser(ctx context.Context, userID uint) ([]models.UserSubscription, error) {
+	var subscriptions []models.UserSubscription
+	err := r.readConn(ctx).Where("user_id = ?", userID).Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+type gormTransactions struct{ gormRepository }
+
+func (r gormTransactions) Get(ctx context.Context, id uint) (models.Transaction, error) {
+	var transaction models.Transaction
+	err := r.conn(ctx).First(&transaction, id).Error
+	return transaction, notFound(err)
+}
+
+func (r gormTransactions) List(ctx context.Context, filter TransactionFilter) ([]models.Transaction, error) {
+	query := r.readConn(ctx).Order("id DESC")
+	if filter.SubscriptionID != 0 {
+		query = query.Where("subscription_id = ?", filter.SubscriptionID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	if filter.Offset > 0 {
+		query = query.Offset(filter.Offset)
+	}
+	var transactions []models.Transaction
+	err := query.Find(&transactions).Error
+	return transactions, err
+}
+
+func (r gormTransactions) Create(ctx context.Context, transaction *models.Transaction) error {
+	transaction.Version = 1
+	return r.conn(ctx).Create(transaction).Error
+}
+
+func (r gormTransactions) Update(ctx context.Context, transaction *models.Transaction) error {
+	conn := r.conn(ctx)
+	result := conn.Model(&models.Transaction{}).
+		Where("id = ? AND version = ?", transaction.ID, transaction.Version).
+		Updates(map[string]interface{}{
+			"subscription_id": transaction.SubscriptionID,
+			"amount":          transaction.Amount.Amount,
+			"currency":        transaction.Amount.Currency,
+			"status":          transaction.Status,
+			"version":         gorm.Expr("version + 1"),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return versionMismatch(conn, &models.Transaction{}, transaction.ID)
+	}
+	return notFound(conn.First(transaction, transaction.ID).Error)
+}
+
+type gormUsers struct{ gormRepository }
+
+func (r gormUsers) Get(ctx context.Context, id int64) (models.User, error) {
+	var user models.User
+	err := r.conn(ctx).First(&user, id).Error
+	return user, notFound(err)
+}
+
+// emailIndex возвращает blind index адреса: email хранится зашифрованным,
+// и искать по нему можно только по HMAC.
+func emailIndex(email string) (*string, error) {
+	if encryption.Default == nil {
+		return nil, encryption.ErrNoKeyring
+	}
+	index := encryption.Default.BlindIndex(encryption.Column("users", "email"), normalizeEmail(email))
+	return &index, nil
+}
+
+// normalizeEmail приводит адрес к виду, по которому строится индекс и ищутся
+// незашифрованные строки, иначе " Alice@x" и "alice@x" считались бы разными.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// GetByEmail ищет по blind index; строки, еще не зашифрованные командой
+// rotate-keys, находятся по открытому email.
+func (r gormUsers) GetByEmail(ctx context.Context, email string) (models.User, error) {
+	email = normalizeEmail(email)
+	index, err := emailIndex(email)
+	if err != nil {
+		return models.User{}, err
+	}
+	var user models.User
+	err = r.conn(ctx).Where("email_index = ? OR (email_index IS NULL AND email = ?)", *index, email).First(&user).Error
+	return user, notFound(err)
+}
+
+func (r gormUsers) GetByConfirmationToken(ctx context.Context, tokenHash string) (models.User, error) {
+	var user models.User
+	err := r.conn(ctx).Where("confirmation_token = ?", tokenHash).First(&user).Error
+	return user, notFound(err)
+}
+
+func (r gormUsers) Create(ctx context.Context, user *models.User) error {
+	index, err := emailIndex(user.Email)
+	if err != nil {
+		return err
+	}
+	user.EmailIndex = index
+	return r.conn(ctx).Create(user).Error
+}
+
+// UpdateFields шифрует name и email сам: при обновлении через map GORM не
+// применяет сериализатор полей.
+func (r gormUsers) UpdateFields(ctx context.Context, id int64, fields map[string]interface{}) error {
+	updates := make(map[string]interface{}, len(fields)+1)
+	for column, value := range fields {
+		updates[column] = value
+	}
+	if email, ok := fields["email"].(string); ok {
+		index, err := emailIndex(email)
+		if err != nil {
+			return err
+		}
+		updates["email_index"] = *index
+	}
+	for _, column := range []string{"name", "email"} {
+		value, ok := fields[column].(string)
+		if !ok {
+			continue
+		}
+		if encryption.Default == nil {
+			return encryption.ErrNoKeyring
+		}
+		encrypted, err := encryption.Default.Encrypt(encryption.Column("users", column), value)
+		if err != nil {
+			return err
+		}
+		updates[column] = encrypted
+	}
+	return r.conn(ctx).Model(&models.User{}).Where("id = ?", id).Updates(updates).Error
+}
+
+func (r gormUsers) SetConfirmationToken(ctx context.Context, id int64, tokenHash string, sentAt time.Time, cooldown time.Duration) error {
+	result := r.conn(ctx).Model(&models.User{}).
+		Where("id = ? AND is_confirmed = ?", id, false).
+		Where("confirmation_sent_at IS NULL OR confirmation_sent_at <= ?", sentAt.Add(-cooldown)).
+		Updates(map[string]interface{}{"confirmation_token": tokenHash, "confirmation_sent_at": sentAt})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrThrottled
+	}
+	return nil
+}
+
+func (r gormUsers) RoleByID(ctx context.Context, id uint) (models.Role, error) {
+	var role models.Role
+	err := r.conn(ctx).Where("id = ?", id).First(&role).Error
+	return role, notFound(err)
+}
+
+func (r gormUsers) RoleByCode(ctx context.Context, code string) (models.Role, error) {
+	var role models.Role
+	err := r.conn(ctx).Where("code = ?", code).First(&role).Error
+	return role, notFound(err)
+}
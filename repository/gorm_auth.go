@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"ass3_part2/models"
+	"context"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type gormSessions struct{ gormRepository }
+
+func (r gormSessions) Create(ctx context.Context, session *models.Session) error {
+	return r.conn(ctx).Create(session).Error
+}
+
+func (r gormSessions) Get(ctx context.Context, id string) (models.Session, error) {
+	var session models.Session
+	err := r.conn(ctx).Where("id = ?", id).First(&session).Error
+	return session, notFound(err)
+}
+
+func (r gormSessions) ListActive(ctx context.Context, userID int64) ([]models.Session, error) {
+	var sessions []models.Session
+	err := r.conn(ctx).Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").Find(&sessions).Error
+	return sessions, err
+}
+
+func (r gormSessions) UpdateFields(ctx context.Context, id string, fields map[string]interface{}) error {
+	return r.conn(ctx).Model(&models.Session{}).Where("id = ?", id).Updates(fields).Error
+}
+
+func (r gormSessions) Revoke(ctx context.Context, id string) error {
+	return r.conn(ctx).Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r gormSessions) RevokeByUser(ctx context.Context, userID int64, exceptID string) ([]string, error) {
+	query := r.conn(ctx).Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+	if exceptID != "" {
+		query = query.Where("id <> ?", exceptID)
+	}
+	var ids []string
+	if err := query.Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	err := r.conn(ctx).Model(&models.Session{}).Where("id IN ?", ids).Update("revoked_at", time.Now()).Error
+	return ids, err
+}
+
+type gormRefreshTokens struct{ gormRepository }
+
+func (r gormRefreshTokens) Create(ctx context.Context, token *models.RefreshToken) error {
+	return r.conn(ctx).Create(token).Error
+}
+
+func (r gormRefreshTokens) GetByHash(ctx context.Context, tokenHash string) (models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := r.lockingConn(ctx).Where("token_hash = ?", tokenHash).First(&token).Error
+	return token, notFound(err)
+}
+
+func (r gormRefreshTokens) MarkUsed(ctx context.Context, id uint) error {
+	return r.conn(ctx).Model(&models.RefreshToken{}).Where("id = ?", id).Update("used_at", time.Now()).Error
+}
+
+type gormPasswordResets struct{ gormRepository }
+
+func (r gormPasswordResets) Create(ctx context.Context, token *models.PasswordResetToken, cooldown time.Duration) error {
+	return r.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		// Блокировка строки пользователя упорядочивает одновременные запросы,
+		// иначе каждый из них не увидел бы токенов остальных.
+		var userID int64
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Table("users").
+			Select("id").Where("id = ?", token.UserID).Scan(&userID).Error; err != nil {
+			return err
+		}
+		var recent int64
+		if err := tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND created_at > ?", token.UserID, time.Now().Add(-cooldown)).
+			Count(&recent).Error; err != nil {
+			return err
+		}
+		if recent > 0 {
+			return ErrThrottled
+		}
+		if err := tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", token.UserID).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(token).Error
+	})
+}
+
+func (r gormPasswordResets) GetByHash(ctx context.Context, tokenHash string) (models.PasswordResetToken, error) {
+	var token models.PasswordResetToken
+	err := r.lockingConn(ctx).Where("token_hash = ?", tokenHash).First(&token).Error
+	return token, notFound(err)
+}
+
+func (r gormPasswordResets) MarkUsed(ctx context.Context, id uint) error {
+	return r.conn(ctx).Model(&models.PasswordResetToken{}).Where("id = ?", id).Update("used_at", time.Now()).Error
+}
+
+type gormSecondFactors struct{ gormRepository }
+
+func (r gormSecondFactors) GetTOTP(ctx context.Context, userID int64) (models.UserTOTP, error) {
+	var userTOTP models.UserTOTP
+	err := r.lockingConn(ctx).Where("user_id = ?", userID).First(&userTOTP).Error
+	return userTOTP, notFound(err)
+}
+
+func (r gormSecondFactors) SaveTOTP(ctx context.Context, userTOTP *models.UserTOTP) error {
+	return r.conn(ctx).Save(userTOTP).Error
+}
+
+func (r gormSecondFactors) UpdateTOTP(ctx context.Context, userID int64, fields map[string]interface{}) error {
+	return r.conn(ctx).Model(&models.UserTOTP{}).Where("user_id = ?", userID).Updates(fields).Error
+}
+
+func (r gormSecondFactors) Delete(ctx context.Context, userID int64) error {
+	return r.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.UserTOTP{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+	})
+}
+
+func (r gormSecondFactors) ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes []string) error {
+	return r.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		for _, codeHash := range codeHashes {
+			if err := tx.Create(&models.RecoveryCode{UserID: userID, CodeHash: codeHash}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r gormSecondFactors) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error) {
+	result := r.conn(ctx).Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+type gormRevokedTokens struct{ gormRepository }
+
+func (r gormRevokedTokens) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	var count int64
+	err := r.conn(ctx).Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error
+	return count > 0, err
+}
+
+func (r gormRevokedTokens) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	if err := r.conn(ctx).Where("expires_at < ?", time.Now()).Delete(&models.RevokedToken{}).Error; err != nil {
+		return err
+	}
+	return r.conn(ctx).Save(&models.RevokedToken{JTI: jti, ExpiresAt: expiresAt}).Error
+}
@@ -0,0 +1,413 @@
+package repository
+
+import (
+	"ass3_part2/models"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryStore хранит данные всех репозиториев в памяти процесса под одной
+// блокировкой, чтобы удаление тарифа видело ссылающиеся на него подписки и
+// транзакции и, как внешние ключи в БД, отклонялось с ErrInUse.
+type memoryStore struct {
+	mu                sync.Mutex
+	nextID            int64
+	plans             map[uint]models.PremiumSubscription
+	userSubscriptions map[uint]models.UserSubscription
+	transactions      map[uint]models.Transaction
+	users             map[int64]models.User
+	roles             map[uint]models.Role
+	sessions          map[string]models.Session
+	refreshTokens     map[uint]models.RefreshToken
+	passwordResets    map[uint]models.PasswordResetToken
+	totps             map[int64]models.UserTOTP
+	recoveryCodes     map[uint]models.RecoveryCode
+	revokedTokens     map[string]models.RevokedToken
+}
+
+// NewMemoryRepositories создает репозитории в памяти - для тестов и локального
+// запуска без Postgres. roles задает справочник ролей.
+func NewMemoryRepositories(roles ...models.Role) Repositories {
+	store := &memoryStore{
+		plans:             make(map[uint]models.PremiumSubscription),
+		userSubscriptions: make(map[uint]models.UserSubscription),
+		transactions:      make(map[uint]models.Transaction),
+		users:             make(map[int64]models.User),
+		roles:             make(map[uint]models.Role),
+		sessions:          make(map[string]models.Session),
+		refreshTokens:     make(map[uint]models.RefreshToken),
+		passwordResets:    make(map[uint]models.PasswordResetToken),
+		totps:             make(map[int64]models.UserTOTP),
+		recoveryCodes:     make(map[uint]models.RecoveryCode),
+		revokedTokens:     make(map[string]models.RevokedToken),
+	}
+	for _, role := range roles {
+		store.roles[role.ID] = role
+	}
+	return Repositories{
+		Plans:             memoryPlans{store},
+		UserSubscriptions: memoryUserSubscriptions{store},
+		Transactions:      memoryTransactions{store},
+		Users:             memoryUsers{store},
+		Sessions:          memorySessions{store},
+		RefreshTokens:     memoryRefreshTokens{store},
+		PasswordResets:    memoryPasswordResets{store},
+		SecondFactors:     memorySecondFactors{store},
+		RevokedTokens:     memoryRevokedTokens{store},
+		Tx:                memoryTransactor{},
+	}
+}
+
+// memoryTransactor не откатывает изменения: хранилище в памяти не конкурирует
+// за строки, и конфликтов сериализации в нем не бывает.
+type memoryTransactor struct{}
+
+func (memoryTransactor) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func (memoryTransactor) InSerializableTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+// now - время в UTC, как его проставляет GORM (см. db.NewDb).
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// id выдает следующий идентификатор; вызывается под s.mu.
+func (s *memoryStore) id() int64 {
+	s.nextID++
+	return s.nextID
+}
+
+type memoryPlans struct{ *memoryStore }
+
+func (r memoryPlans) List(ctx context.Context) ([]models.PremiumSubscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	plans := make([]models.PremiumSubscription, 0, len(r.plans))
+	for _, plan := range r.plans {
+		if plan.Status != models.PlanStatusArchived {
+			plans = append(plans, plan)
+		}
+	}
+	sort.Slice(plans, func(i, j int) bool { return plans[i].ID < plans[j].ID })
+	return plans, nil
+}
+
+func (r memoryPlans) Get(ctx context.Context, id uint) (models.PremiumSubscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	plan, ok := r.plans[id]
+	if !ok {
+		return plan, ErrNotFound
+	}
+	return plan, nil
+}
+
+func (r memoryPlans) Create(ctx context.Context, plan *models.PremiumSubscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if plan.ID == 0 {
+		plan.ID = uint(r.id())
+	}
+	if plan.Status == "" {
+		plan.Status = models.PlanStatusActive
+	}
+	plan.Version = 1
+	plan.CreatedAt, plan.UpdatedAt = now(), now()
+	r.plans[plan.ID] = *plan
+	return nil
+}
+
+// checkVersion сверяет ожидаемую версию с текущей; 0 означает любую.
+func checkVersion(current, expected int64) error {
+	if expected != 0 && current != expected {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+func (r memoryPlans) Update(ctx context.Context, plan *models.PremiumSubscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	current, ok := r.plans[plan.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if current.Version != plan.Version {
+		return ErrVersionConflict
+	}
+	current.Plan, current.Period, current.Price = plan.Plan, plan.Period, plan.Price
+	current.Version++
+	current.UpdatedAt = now()
+	r.plans[plan.ID] = current
+	*plan = current
+	return nil
+}
+
+func (r memoryPlans) Archive(ctx context.Context, id uint, version int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	plan, ok := r.plans[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if err := checkVersion(plan.Version, version); err != nil {
+		return err
+	}
+	plan.Status = models.PlanStatusArchived
+	plan.Version++
+	plan.UpdatedAt = now()
+	r.plans[id] = plan
+	return nil
+}
+
+func (r memoryPlans) Delete(ctx context.Context, id uint, version int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	plan, ok := r.plans[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if err := checkVersion(plan.Version, version); err != nil {
+		return err
+	}
+	for _, subscription := range r.userSubscriptions {
+		if subscription.SubscriptionID == id {
+			return ErrInUse
+		}
+	}
+	for _, transaction := range r.transactions {
+		if transaction.SubscriptionID == id {
+			return ErrInUse
+		}
+	}
+	delete(r.plans, id)
+	return nil
+}
+
+type memoryUserSubscriptions struct{ *memoryStore }
+
+func (r memoryUserSubscriptions) Create(ctx context.Context, subscription *models.UserSubscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if subscription.ID == 0 {
+		subscription.ID = uint(r.id())
+	}
+	subscription.CreatedAt, subscription.UpdatedAt = now(), now()
+	r.userSubscriptions[subscription.ID] = *subscription
+	return nil
+}
+
+func (r memoryUserSubscriptions) ListByUser(ctx context.Context, userID uint) ([]models.UserSubscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var subscriptions []models.UserSubscription
+	for _, subscription := range r.userSubscriptions {
+		if subscription.UserID == userID {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	sort.Slice(subscriptions, func(i, j int) bool { return subscriptions[i].ID < subscriptions[j].ID })
+	return subscriptions, nil
+}
+
+type memoryTransactions struct{ *memoryStore }
+
+func (r memoryTransactions) Get(ctx context.Context, id uint) (models.Transaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	transaction, ok := r.transactions[id]
+	if !ok {
+		return transaction, ErrNotFound
+	}
+	return transaction, nil
+}
+
+func (r memoryTransactions) List(ctx context.Context, filter TransactionFilter) ([]models.Transaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var transactions []models.Transaction
+	for _, transaction := range r.transactions {
+		if filter.SubscriptionID != 0 && transaction.SubscriptionID != filter.SubscriptionID {
+			continue
+		}
+		if filter.Status != "" && transaction.Status != filter.Status {
+			continue
+		}
+		transactions = append(transactions, transaction)
+	}
+	sort.Slice(transactions, func(i, j int) bool { return transactions[i].ID > transactions[j].ID })
+	if filter.Offset > 0 {
+		if filter.Offset >= len(transactions) {
+			return nil, nil
+		}
+		transactions = transactions[filter.Offset:]
+	}
+	if filter.Limit > 0 && len(transactions) > filter.Limit {
+		transactions = transactions[:filter.Limit]
+	}
+	return transactions, nil
+}
+
+func (r memoryTransactions) Create(ctx context.Context, transaction *models.Transaction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if transaction.ID == 0 {
+		transaction.ID = uint(r.id())
+	}
+	transaction.Version = 1
+	transaction.CreatedAt, transaction.UpdatedAt = now(), now()
+	r.transactions[transaction.ID] = *transaction
+	return nil
+}
+
+func (r memoryTransactions) Update(ctx context.Context, transaction *models.Transaction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	current, ok := r.transactions[transaction.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if current.Version != transaction.Version {
+		return ErrVersionConflict
+	}
+	current.SubscriptionID, current.Amount, current.Status = transaction.SubscriptionID, transaction.Amount, transaction.Status
+	current.Version++
+	current.UpdatedAt = now()
+	r.transactions[transaction.ID] = current
+	*transaction = current
+	return nil
+}
+
+type memoryUsers struct{ *memoryStore }
+
+func (r memoryUsers) Get(ctx context.Context, id int64) (models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[id]
+	if !ok {
+		return user, ErrNotFound
+	}
+	return user, nil
+}
+
+func (r memoryUsers) find(match func(models.User) bool) (models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, user := range r.users {
+		if match(user) {
+			return user, nil
+		}
+	}
+	return models.User{}, ErrNotFound
+}
+
+func (r memoryUsers) GetByEmail(ctx context.Context, email string) (models.User, error) {
+	return r.find(func(user models.User) bool { return user.Email == email })
+}
+
+func (r memoryUsers) GetByConfirmationToken(ctx context.Context, tokenHash string) (models.User, error) {
+	return r.find(func(user models.User) bool {
+		return user.ConfirmationToken != nil && *user.ConfirmationToken == tokenHash
+	})
+}
+
+func (r memoryUsers) Create(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.users {
+		if existing.Email == user.Email {
+			return fmt.Errorf("email %q is already registered", user.Email)
+		}
+	}
+	// Как и внешний ключ users.role_id, роль должна существовать.
+	if _, ok := r.roles[user.RoleID]; !ok {
+		return fmt.Errorf("role %d does not exist", user.RoleID)
+	}
+	if user.ID == 0 {
+		user.ID = r.id()
+	}
+	user.CreatedAt, user.UpdatedAt = now(), now()
+	r.users[user.ID] = *user
+	return nil
+}
+
+// UpdateFields понимает те же имена колонок, что и GORM-реализация.
+func (r memoryUsers) UpdateFields(ctx context.Context, id int64, fields map[string]interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	for column, value := range fields {
+		switch column {
+		case "name":
+			user.Name = value.(string)
+		case "email":
+			user.Email = value.(string)
+		case "password":
+			user.Password = value.(string)
+		case "role_id":
+			user.RoleID = value.(uint)
+		case "is_confirmed":
+			user.IsConfirmed = value.(bool)
+		case "confirmation_token":
+			user.ConfirmationToken = nil
+			if token, ok := value.(string); ok {
+				user.ConfirmationToken = &token
+			}
+		case "confirmation_sent_at":
+			user.ConfirmationSentAt = nil
+			if sentAt, ok := value.(time.Time); ok {
+				user.ConfirmationSentAt = &sentAt
+			}
+		default:
+			return fmt.Errorf("unknown user column %q", column)
+		}
+	}
+	user.UpdatedAt = now()
+	r.users[id] = user
+	return nil
+}
+
+func (r memoryUsers) SetConfirmationToken(ctx context.Context, id int64, tokenHash string, sentAt time.Time, cooldown time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[id]
+	if !ok || user.IsConfirmed || user.ConfirmationSentAt != nil && user.ConfirmationSentAt.After(sentAt.Add(-cooldown)) {
+		return ErrThrottled
+	}
+	user.ConfirmationToken = &tokenHash
+	user.ConfirmationSentAt = &sentAt
+	user.UpdatedAt = now()
+	r.users[id] = user
+	return nil
+}
+
+func (r memoryUsers) RoleByID(ctx context.Context, id uint) (models.Role, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	role, ok := r.roles[id]
+	if !ok {
+		return role, ErrNotFound
+	}
+	return role, nil
+}
+
+func (r memoryUsers) RoleByCode(ctx context.Context, code string) (models.Role, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, role := range r.roles {
+		if role.Code == code {
+			return role, nil
+		}
+	}
+	return models.Role{}, ErrNotFound
+}
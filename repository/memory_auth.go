@@ -0,0 +1,299 @@
+package repository
+
+import (
+	"ass3_part2/models"
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+type memorySessions struct{ *memoryStore }
+
+func (r memorySessions) Create(ctx context.Context, session *models.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.sessions[session.ID]; ok {
+		return fmt.Errorf("session %q already exists", session.ID)
+	}
+	session.CreatedAt, session.UpdatedAt = now(), now()
+	r.sessions[session.ID] = *session
+	return nil
+}
+
+func (r memorySessions) Get(ctx context.Context, id string) (models.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	session, ok := r.sessions[id]
+	if !ok {
+		return session, ErrNotFound
+	}
+	return session, nil
+}
+
+func (r memorySessions) ListActive(ctx context.Context, userID int64) ([]models.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var sessions []models.Session
+	for _, session := range r.sessions {
+		if session.UserID == userID && session.RevokedAt == nil && session.ExpiresAt.After(time.Now()) {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt) })
+	return sessions, nil
+}
+
+// UpdateFields понимает те же имена колонок, что и GORM-реализация.
+func (r memorySessions) UpdateFields(ctx context.Context, id string, fields map[string]interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	session, ok := r.sessions[id]
+	if !ok {
+		return nil
+	}
+	for column, value := range fields {
+		switch column {
+		case "last_seen_at":
+			session.LastSeenAt = value.(time.Time)
+		case "ip":
+			session.IP = value.(string)
+		case "auth_time":
+			session.AuthTime = value.(time.Time)
+		case "amr":
+			session.AMR = value.(string)
+		default:
+			return fmt.Errorf("unknown session column %q", column)
+		}
+	}
+	session.UpdatedAt = now()
+	r.sessions[id] = session
+	return nil
+}
+
+// revoke отзывает сессию; вызывается под r.mu.
+func (r memorySessions) revoke(session models.Session) {
+	revokedAt := now()
+	session.RevokedAt = &revokedAt
+	session.UpdatedAt = revokedAt
+	r.sessions[session.ID] = session
+}
+
+func (r memorySessions) Revoke(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if session, ok := r.sessions[id]; ok && session.RevokedAt == nil {
+		r.revoke(session)
+	}
+	return nil
+}
+
+func (r memorySessions) RevokeByUser(ctx context.Context, userID int64, exceptID string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ids []string
+	for id, session := range r.sessions {
+		if session.UserID == userID && session.RevokedAt == nil && id != exceptID {
+			r.revoke(session)
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+type memoryRefreshTokens struct{ *memoryStore }
+
+func (r memoryRefreshTokens) Create(ctx context.Context, token *models.RefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if token.ID == 0 {
+		token.ID = uint(r.id())
+	}
+	token.CreatedAt = now()
+	r.refreshTokens[token.ID] = *token
+	return nil
+}
+
+func (r memoryRefreshTokens) GetByHash(ctx context.Context, tokenHash string) (models.RefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, token := range r.refreshTokens {
+		if token.TokenHash == tokenHash {
+			return token, nil
+		}
+	}
+	return models.RefreshToken{}, ErrNotFound
+}
+
+func (r memoryRefreshTokens) MarkUsed(ctx context.Context, id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if token, ok := r.refreshTokens[id]; ok {
+		usedAt := now()
+		token.UsedAt = &usedAt
+		r.refreshTokens[id] = token
+	}
+	return nil
+}
+
+type memoryPasswordResets struct{ *memoryStore }
+
+func (r memoryPasswordResets) Create(ctx context.Context, token *models.PasswordResetToken, cooldown time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.passwordResets {
+		if existing.UserID == token.UserID && existing.CreatedAt.After(now().Add(-cooldown)) {
+			return ErrThrottled
+		}
+	}
+	for id, existing := range r.passwordResets {
+		if existing.UserID == token.UserID && existing.UsedAt == nil {
+			usedAt := now()
+			existing.UsedAt = &usedAt
+			r.passwordResets[id] = existing
+		}
+	}
+	if token.ID == 0 {
+		token.ID = uint(r.id())
+	}
+	token.CreatedAt = now()
+	r.passwordResets[token.ID] = *token
+	return nil
+}
+
+func (r memoryPasswordResets) GetByHash(ctx context.Context, tokenHash string) (models.PasswordResetToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, token := range r.passwordResets {
+		if token.TokenHash == tokenHash {
+			return token, nil
+		}
+	}
+	return models.PasswordResetToken{}, ErrNotFound
+}
+
+func (r memoryPasswordResets) MarkUsed(ctx context.Context, id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if token, ok := r.passwordResets[id]; ok {
+		usedAt := now()
+		token.UsedAt = &usedAt
+		r.passwordResets[id] = token
+	}
+	return nil
+}
+
+type memorySecondFactors struct{ *memoryStore }
+
+func (r memorySecondFactors) GetTOTP(ctx context.Context, userID int64) (models.UserTOTP, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	userTOTP, ok := r.totps[userID]
+	if !ok {
+		return userTOTP, ErrNotFound
+	}
+	return userTOTP, nil
+}
+
+func (r memorySecondFactors) SaveTOTP(ctx context.Context, userTOTP *models.UserTOTP) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.totps[userTOTP.UserID]; ok {
+		userTOTP.CreatedAt = existing.CreatedAt
+	} else {
+		userTOTP.CreatedAt = now()
+	}
+	userTOTP.UpdatedAt = now()
+	r.totps[userTOTP.UserID] = *userTOTP
+	return nil
+}
+
+// UpdateTOTP понимает те же имена колонок, что и GORM-реализация.
+func (r memorySecondFactors) UpdateTOTP(ctx context.Context, userID int64, fields map[string]interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	userTOTP, ok := r.totps[userID]
+	if !ok {
+		return nil
+	}
+	for column, value := range fields {
+		switch column {
+		case "enabled":
+			userTOTP.Enabled = value.(bool)
+		case "last_used_step":
+			userTOTP.LastUsedStep = value.(int64)
+		case "confirmed_at":
+			confirmedAt := value.(time.Time)
+			userTOTP.ConfirmedAt = &confirmedAt
+		default:
+			return fmt.Errorf("unknown TOTP column %q", column)
+		}
+	}
+	userTOTP.UpdatedAt = now()
+	r.totps[userID] = userTOTP
+	return nil
+}
+
+// deleteRecoveryCodes удаляет коды пользователя; вызывается под r.mu.
+func (r memorySecondFactors) deleteRecoveryCodes(userID int64) {
+	for id, code := range r.recoveryCodes {
+		if code.UserID == userID {
+			delete(r.recoveryCodes, id)
+		}
+	}
+}
+
+func (r memorySecondFactors) Delete(ctx context.Context, userID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.totps, userID)
+	r.deleteRecoveryCodes(userID)
+	return nil
+}
+
+func (r memorySecondFactors) ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deleteRecoveryCodes(userID)
+	for _, codeHash := range codeHashes {
+		id := uint(r.id())
+		r.recoveryCodes[id] = models.RecoveryCode{ID: id, UserID: userID, CodeHash: codeHash, CreatedAt: now()}
+	}
+	return nil
+}
+
+func (r memorySecondFactors) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, code := range r.recoveryCodes {
+		if code.UserID == userID && code.CodeHash == codeHash && code.UsedAt == nil {
+			usedAt := now()
+			code.UsedAt = &usedAt
+			r.recoveryCodes[id] = code
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type memoryRevokedTokens struct{ *memoryStore }
+
+func (r memoryRevokedTokens) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.revokedTokens[jti]
+	return ok, nil
+}
+
+func (r memoryRevokedTokens) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, token := range r.revokedTokens {
+		if token.ExpiresAt.Before(time.Now()) {
+			delete(r.revokedTokens, id)
+		}
+	}
+	r.revokedTokens[jti] = models.RevokedToken{JTI: jti, ExpiresAt: expiresAt, CreatedAt: now()}
+	return nil
+}
@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"ass3_part2/models"
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotFound возвращается, если запись не найдена.
+	ErrNotFound = errors.New("record not found")
+	// ErrInUse возвращается, если удаление оставило бы связанные записи без родителя.
+	ErrInUse = errors.New("record is referenced by other records")
+	// ErrVersionConflict возвращается, если запись изменили после чтения
+	// (версия в запросе не совпадает с текущей).
+	ErrVersionConflict = errors.New("record version conflict")
+	// ErrThrottled возвращается, если письмо на этот адрес уже отправлялось
+	// недавно и новый токен не выпущен.
+	ErrThrottled = errors.New("token was issued too recently")
+)
+
+// PlanRepository хранит тарифы премиум-подписки (таблица premium_subscriptions).
+type PlanRepository interface {
+	// List возвращает тарифы каталога; архивные не включаются. Может читать с реплики.
+	List(ctx context.Context) ([]models.PremiumSubscription, error)
+	// Get возвращает тариф по id, в том числе архивный.
+	Get(ctx context.Context, id uint) (models.PremiumSubscription, error)
+	Create(ctx context.Context, plan *models.PremiumSubscription) error
+	// Update сохраняет название, период и цену тарифа, если его версия все еще
+	// равна plan.Version, иначе возвращает ErrVersionConflict. Версия увеличивается.
+	// Статус меняется только через Archive.
+	Update(ctx context.Context, plan *models.PremiumSubscription) error
+	// Archive переводит тариф в статус archived, не трогая подписки и транзакции.
+	// Ненулевая version задает ожидаемую версию тарифа.
+	Archive(ctx context.Context, id uint, version int64) error
+	// Delete физически удаляет тариф; если по нему есть подписки или
+	// транзакции, возвращает ErrInUse. Ненулевая version задает ожидаемую версию.
+	Delete(ctx context.Context, id uint, version int64) error
+}
+
+// UserSubscriptionRepository хранит оформленные пользователями подписки.
+type UserSubscriptionRepository interface {
+	Create(ctx context.Context, subscription *models.UserSubscription) error
+	// ListByUser может читать с реплики.
+	ListByUser(ctx context.Context, userID uint) ([]models.UserSubscription, error)
+}
+
+// TransactionFilter задает выборку из истории транзакций; нулевые поля не фильтруют.
+type TransactionFilter struct {
+	SubscriptionID uint
+	Status         string
+	Limit          int
+	Offset         int
+}
+
+// TransactionRepository хранит платежные транзакции.
+type TransactionRepository interface {
+	Get(ctx context.Context, id uint) (models.Transaction, error)
+	// List возвращает историю транзакций, новые первыми. Может читать с реплики,
+	// поэтому только что созданные транзакции могут появиться не сразу.
+	List(ctx context.Context, filter TransactionFilter) ([]models.Transaction, error)
+	Create(ctx context.Context, transaction *models.Transaction) error
+	// Update, как и для тарифов, проверяет и увеличивает transaction.Version.
+	Update(ctx context.Context, transaction *models.Transaction) error
+}
+
+// UserRepository хранит пользователей и справочник ролей.
+type UserRepository interface {
+	Get(ctx context.Context, id int64) (models.User, error)
+	GetByEmail(ctx context.Context, email string) (models.User, error)
+	// GetByConfirmationToken ищет пользователя по хешу токена подтверждения email.
+	GetByConfirmationToken(ctx context.Context, tokenHash string) (models.User, error)
+	Create(ctx context.Context, user *models.User) error
+	// UpdateFields обновляет перечисленные колонки пользователя.
+	UpdateFields(ctx context.Context, id int64, fields map[string]interface{}) error
+	// SetConfirmationToken атомарно сохраняет хеш нового токена подтверждения, если
+	// email еще не подтвержден и прошлое письмо отправлено не позже чем за cooldown
+	// до sentAt; иначе возвращает ErrThrottled.
+	SetConfirmationToken(ctx context.Context, id int64, tokenHash string, sentAt time.Time, cooldown time.Duration) error
+	RoleByID(ctx context.Context, id uint) (models.Role, error)
+	RoleByCode(ctx context.Context, code string) (models.Role, error)
+}
+
+// SessionRepository хранит сессии входа пользователей.
+type SessionRepository interface {
+	Create(ctx context.Context, session *models.Session) error
+	Get(ctx context.Context, id string) (models.Session, error)
+	// ListActive возвращает неотозванные и не истекшие сессии пользователя, недавние первыми.
+	ListActive(ctx context.Context, userID int64) ([]models.Session, error)
+	// UpdateFields обновляет перечисленные колонки сессии.
+	UpdateFields(ctx context.Context, id string, fields map[string]interface{}) error
+	// Revoke отзывает сессию, если она еще не отозвана.
+	Revoke(ctx context.Context, id string) error
+	// RevokeByUser отзывает активные сессии пользователя, кроме exceptID
+	// (если он задан), и возвращает их id.
+	RevokeByUser(ctx context.Context, userID int64, exceptID string) ([]string, error)
+}
+
+// RefreshTokenRepository хранит хеши refresh-токенов.
+type RefreshTokenRepository interface {
+	Create(ctx context.Context, token *models.RefreshToken) error
+	// GetByHash внутри транзакции блокирует строку до ее завершения.
+	GetByHash(ctx context.Context, tokenHash string) (models.RefreshToken, error)
+	MarkUsed(ctx context.Context, id uint) error
+}
+
+// PasswordResetRepository хранит хеши токенов сброса пароля.
+type PasswordResetRepository interface {
+	// Create сохраняет новый токен, погашая прежние неиспользованные токены
+	// пользователя. Если предыдущий токен выпущен меньше cooldown назад, ничего
+	// не меняет и возвращает ErrThrottled.
+	Create(ctx context.Context, token *models.PasswordResetToken, cooldown time.Duration) error
+	// GetByHash внутри транзакции блокирует строку до ее завершения.
+	GetByHash(ctx context.Context, tokenHash string) (models.PasswordResetToken, error)
+	MarkUsed(ctx context.Context, id uint) error
+}
+
+// SecondFactorRepository хранит TOTP-секреты и коды восстановления.
+type SecondFactorRepository interface {
+	// GetTOTP внутри транзакции блокирует строку до ее завершения.
+	GetTOTP(ctx context.Context, userID int64) (models.UserTOTP, error)
+	// SaveTOTP создает или заменяет секрет пользователя.
+	SaveTOTP(ctx context.Context, userTOTP *models.UserTOTP) error
+	// UpdateTOTP обновляет перечисленные колонки секрета.
+	UpdateTOTP(ctx context.Context, userID int64, fields map[string]interface{}) error
+	// Delete удаляет секрет и коды восстановления пользователя.
+	Delete(ctx context.Context, userID int64) error
+	// ReplaceRecoveryCodes заменяет коды восстановления пользователя новыми (хешами).
+	ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes []string) error
+	// UseRecoveryCode погашает неиспользованный код; false, если такого кода нет.
+	UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error)
+}
+
+// RevokedTokenRepository хранит jti отозванных до истечения срока access-токенов.
+type RevokedTokenRepository interface {
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+	// Revoke заносит jti в список отзыва и попутно удаляет истекшие записи.
+	Revoke(ctx context.Context, jti string, expiresAt time.Time) error
+}
+
+// Transactor выполняет несколько операций репозиториев атомарно: репозитории,
+// вызванные с контекстом, который получает fn, работают внутри транзакции.
+type Transactor interface {
+	// InTx выполняет fn в обычной транзакции без повторов.
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+	// InSerializableTx выполняет fn в транзакции SERIALIZABLE. При конфликте
+	// сериализации или взаимоблокировке транзакция повторяется целиком, поэтому
+	// fn не должна иметь побочных эффектов вне базы.
+	InSerializableTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// Repositories - набор репозиториев одного хранилища.
+type Repositories struct {
+	Plans             PlanRepository
+	UserSubscriptions UserSubscriptionRepository
+	Transactions      TransactionRepository
+	Users             UserRepository
+	Sessions          SessionRepository
+	RefreshTokens     RefreshTokenRepository
+	PasswordResets    PasswordResetRepository
+	SecondFactors     SecondFactorRepository
+	RevokedTokens     RevokedTokenRepository
+	Tx                Transactor
+}
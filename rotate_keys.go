@@ -0,0 +1,91 @@
+package main
+
+import (
+	db "ass3_part2/db/migrations"
+	"ass3_part2/encryption"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// rotateBatchSize - сколько пользователей перешифровывается в одной транзакции.
+const rotateBatchSize = 500
+
+type encryptedUserRow struct {
+	ID         int64
+	Name       string
+	Email      string
+	EmailIndex *string
+}
+
+// runRotateKeys выполняет подкоманду "rotate-keys": шифрует имена и email,
+// записанные до включения шифрования, перешифровывает ключи данных значений
+// активным ключом (ENCRYPTION_ACTIVE_KEY) и пересчитывает blind index email.
+// После нее старый ключ можно убрать из ENCRYPTION_KEYS.
+func runRotateKeys(ctx context.Context, keyring *encryption.Keyring) error {
+	var lastID int64
+	var rotated, total int
+	for {
+		// Колонки читаются как есть, в обход сериализатора модели User.
+		var rows []encryptedUserRow
+		err := db.DB.WithContext(ctx).Table("users").
+			Select("id, name, email, email_index").
+			Where("id > ?", lastID).Order("id").Limit(rotateBatchSize).
+			Find(&rows).Error
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			break
+		}
+		lastID = rows[len(rows)-1].ID
+		total += len(rows)
+
+		tx := db.DB.WithContext(ctx).Begin()
+		for _, row := range rows {
+			updates, err := rotateUserRow(keyring, row)
+			if err != nil {
+				tx.Rollback()
+				return fmt.Errorf("user %d: %w", row.ID, err)
+			}
+			if len(updates) == 0 {
+				continue
+			}
+			if err := tx.Table("users").Where("id = ?", row.ID).Updates(updates).Error; err != nil {
+				tx.Rollback()
+				return fmt.Errorf("user %d: %w", row.ID, err)
+			}
+			rotated++
+		}
+		if err := tx.Commit().Error; err != nil {
+			return err
+		}
+	}
+	fmt.Printf("rotated %d of %d users to key %q\n", rotated, total, keyring.ActiveKeyID())
+	return nil
+}
+
+// rotateUserRow возвращает изменившиеся колонки строки пользователя.
+func rotateUserRow(keyring *encryption.Keyring, row encryptedUserRow) (map[string]interface{}, error) {
+	updates := map[string]interface{}{}
+	for column, value := range map[string]string{"name": row.Name, "email": row.Email} {
+		rewrapped, changed, err := keyring.Rewrap(encryption.Column("users", column), value)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			updates[column] = rewrapped
+		}
+	}
+
+	email, err := keyring.Decrypt(encryption.Column("users", "email"), row.Email)
+	if err != nil {
+		return nil, err
+	}
+	// Как и в repository.emailIndex, индекс строится по нормализованному адресу.
+	index := keyring.BlindIndex(encryption.Column("users", "email"), strings.ToLower(strings.TrimSpace(email)))
+	if row.EmailIndex == nil || *row.EmailIndex != index {
+		updates["email_index"] = index
+	}
+	return updates, nil
+}
@@ -3,37 +3,107 @@ package router
 import (
 	"ass3_part2/controllers"
 	"ass3_part2/middleware"
+	"ass3_part2/repository"
+	"ass3_part2/tracing"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
 	"net/http"
 )
 
-func NewRouter() http.Handler {
+// Dependencies - контроллеры и сервисы, которые main передает роутеру.
+type Dependencies struct {
+	Auth          *controllers.AuthController
+	Subscriptions *controllers.SubscriptionController
+	Payments      *controllers.PaymentController
+	Users         repository.UserRepository
+	SecondFactor  *middleware.SecondFactorVerifier
+}
+
+func NewRouter(deps Dependencies) http.Handler {
 	router := mux.NewRouter()
+	auth := deps.Auth
 
-	router.Use(middleware.CORSMiddleware)
+	router.Use(otelmux.Middleware(tracing.ServiceName))
+	router.Use(middleware.RouteInfo)
 	router.Use(middleware.RateLimit)
+	router.Use(middleware.LimitBody)
 
 	authRoutes := router.PathPrefix("/").Subrouter()
 	authRoutes.Use(middleware.MiddlewareAuth)
 
 	router.HandleFunc("/index", serveHTML("static/index.html"))
+	router.Handle("/metrics", promhttp.Handler()).Methods("GET")
+
+	router.HandleFunc("/auth/register", auth.Register).Methods("POST")
+	router.HandleFunc("/auth/login", auth.Login).Methods("POST")
+	router.HandleFunc("/auth/refresh", auth.Refresh).Methods("POST")
+	router.HandleFunc("/auth/logout", auth.Logout).Methods("POST")
+	router.HandleFunc("/auth/confirm", auth.ConfirmEmail).Methods("GET")
+	router.HandleFunc("/auth/confirm/resend", auth.ResendConfirmation).Methods("POST")
+	router.HandleFunc("/auth/password/forgot", auth.ForgotPassword).Methods("POST")
+	router.HandleFunc("/auth/password/reset", auth.ResetPassword).Methods("POST")
+	router.Handle("/auth/step-up", middleware.MiddlewareAuth(http.HandlerFunc(auth.StepUp))).Methods("POST")
+
+	meRoutes := router.PathPrefix("/me").Subrouter()
+	meRoutes.Use(middleware.MiddlewareAuth)
+	meRoutes.HandleFunc("/password", auth.ChangePassword).Methods("PUT")
+	meRoutes.HandleFunc("/sessions", auth.ListSessions).Methods("GET")
+	meRoutes.HandleFunc("/sessions/{id}", auth.RevokeSession).Methods("DELETE")
+	meRoutes.HandleFunc("/2fa/totp", auth.EnrollTOTP).Methods("POST")
+	meRoutes.HandleFunc("/2fa/totp/confirm", auth.ConfirmTOTP).Methods("POST")
+	meRoutes.Handle("/2fa/totp", deps.SecondFactor.RequireStepUp(http.HandlerFunc(auth.DisableTOTP))).Methods("DELETE")
+	meRoutes.Handle("/2fa/recovery-codes", deps.SecondFactor.RequireStepUp(http.HandlerFunc(auth.RegenerateRecoveryCodes))).Methods("POST")
 
 	adminRoutes := router.PathPrefix("/admin").Subrouter()
 	//adminRoutes.Use(middleware.MiddlewareAuth)
 	//adminRoutes.Use(middleware.MiddlewareRole("admin"))
-	adminRoutes.HandleFunc("/subscription", controllers.CreateSubscription).Methods("POST")
-	router.HandleFunc("/subscription/{id}", controllers.GetSubscription).Methods("GET")
-	router.HandleFunc("/subscription", controllers.GetAllSubscriptions).Methods("GET")
-	adminRoutes.HandleFunc("/subscription/{id}", controllers.DeleteSubscription).Methods("DELETE")
-	adminRoutes.HandleFunc("/subscription/{id}", controllers.UpdateSubscription).Methods("PUT")
+	adminRoutes.Handle("/subscription", adminOnly(deps, deps.Subscriptions.CreateSubscription)).Methods("POST")
+	router.HandleFunc("/subscription/{id}", deps.Subscriptions.GetSubscription).Methods("GET")
+	router.HandleFunc("/subscription", deps.Subscriptions.GetAllSubscriptions).Methods("GET")
+	adminRoutes.Handle("/subscription/{id}", adminStepUp(deps, deps.Subscriptions.DeleteSubscription)).Methods("DELETE")
+	adminRoutes.Handle("/subscription/{id}", adminOnly(deps, deps.Subscriptions.UpdateSubscription)).Methods("PUT")
+	adminRoutes.Handle("/transactions", adminOnly(deps, deps.Payments.ListTransactions)).Methods("GET")
+	adminRoutes.Handle("/users/{id}/sessions", adminStepUp(deps, auth.RevokeAllUserSessions)).Methods("DELETE")
 
-	router.HandleFunc("/payment", controllers.PaySubscription).Methods("POST")
+	router.HandleFunc("/payment", deps.Payments.PaySubscription).Methods("POST")
 	//middleware only here!
 
-	return middleware.CORSMiddleware(router)
+	handler := middleware.RequestID(middleware.AccessLog(middleware.Recovery(middleware.SecurityHeaders(
+		middleware.RequestTimeout(middleware.CORS(middleware.CORSPolicy, router))))))
+	return withProbes(handler)
+}
+
+// withProbes обслуживает /healthz и /readyz в обход остальных middleware:
+// пробы не должны упираться в лимиты запросов и засорять журнал доступа.
+func withProbes(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz":
+			controllers.Healthz(w, r)
+		case "/readyz":
+			controllers.Readyz(w, r)
+		default:
+			handler.ServeHTTP(w, r)
+		}
+	})
 }
+
+// adminOnly оборачивает обработчик проверкой токена и роли администратора.
+func adminOnly(deps Dependencies, handler http.HandlerFunc) http.Handler {
+	return middleware.MiddlewareAuth(middleware.MiddlewareRole(deps.Users, "admin")(handler))
+}
+
+// adminStepUp дополнительно требует недавнего подтверждения второго фактора
+// для необратимых административных действий. Роль проверяется первой, чтобы
+// не-администратор не расходовал шаг TOTP или код восстановления ради 403.
+func adminStepUp(deps Dependencies, handler http.HandlerFunc) http.Handler {
+	return middleware.MiddlewareAuth(middleware.MiddlewareRole(deps.Users, "admin")(deps.SecondFactor.RequireStepUp(handler)))
+}
+
 func serveHTML(filePath string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", middleware.StaticPageCSP)
 		http.ServeFile(w, r, filePath)
 	}
 }
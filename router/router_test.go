@@ -0,0 +1,127 @@
+package router
+
+import (
+	"ass3_part2/controllers"
+	"ass3_part2/logging"
+	"ass3_part2/middleware"
+	"ass3_part2/models"
+	"ass3_part2/repository"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go.uber.org/zap"
+)
+
+// TestAdminStepUpChecksSessionNotClaims проверяет, что amr=otp в токене без
+// подтвержденного второго фактора в сессии не проходит step-up.
+func TestAdminStepUpChecksSessionNotClaims(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	middleware.JwtKey = bytes.Repeat([]byte{9}, 32)
+	repos := repository.NewMemoryRepositories(
+		models.Role{ID: 1, Name: "User", Code: "user"},
+		models.Role{ID: 2, Name: "Admin", Code: "admin"},
+	)
+	middleware.Revocations = middleware.NewRevocationStore(repos)
+	deps := Dependencies{Users: repos.Users, SecondFactor: middleware.NewSecondFactorVerifier(repos)}
+
+	ctx := context.Background()
+	admin := models.User{Name: "Admin", Email: "admin@example.com", RoleID: 2, IsConfirmed: true}
+	if err := repos.Users.Create(ctx, &admin); err != nil {
+		t.Fatal(err)
+	}
+	session := models.Session{
+		ID:        "session-1",
+		UserID:    admin.ID,
+		AuthTime:  time.Now(),
+		AMR:       "pwd",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	if err := repos.Sessions.Create(ctx, &session); err != nil {
+		t.Fatal(err)
+	}
+
+	// Токен подписан верным ключом, но amr и auth_time в нем не совпадают с сессией.
+	now := time.Now()
+	claims := &middleware.Claims{
+		Email:     admin.Email,
+		SessionID: session.ID,
+		AuthTime:  jwt.NewNumericDate(now),
+		AMR:       []string{"pwd", "otp"},
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "jti-1",
+			Subject:   strconv.FormatInt(admin.ID, 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(middleware.JwtKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := adminStepUp(deps, func(w http.ResponseWriter, r *http.Request) {})
+	call := func() int {
+		req := httptest.NewRequest(http.MethodDelete, "/admin/subscription/1", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := call(); code != http.StatusUnauthorized {
+		t.Fatalf("amr=otp only in token: status %d, want 401", code)
+	}
+
+	if err := repos.Sessions.UpdateFields(ctx, session.ID, map[string]interface{}{"amr": "pwd,otp", "auth_time": time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if code := call(); code != http.StatusOK {
+		t.Fatalf("step-up recorded in session: status %d, want 200", code)
+	}
+}
+
+func TestPlanWritesRequireAdmin(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	middleware.JwtKey = bytes.Repeat([]byte{9}, 32)
+	rateLimitConfig, err := middleware.LoadRateLimitConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	middleware.Limiter = middleware.NewKeyedLimiter(rateLimitConfig)
+	hardeningConfig, err := middleware.LoadHardeningConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	middleware.Hardening = hardeningConfig
+
+	repos := repository.NewMemoryRepositories(models.Role{ID: 1, Name: "User", Code: "user"})
+	middleware.Revocations = middleware.NewRevocationStore(repos)
+	secondFactor := middleware.NewSecondFactorVerifier(repos)
+	handler := NewRouter(Dependencies{
+		Auth:          controllers.NewAuthController(repos, secondFactor),
+		Subscriptions: controllers.NewSubscriptionController(repos.Plans),
+		Payments:      controllers.NewPaymentController(repos),
+		Users:         repos.Users,
+		SecondFactor:  secondFactor,
+	})
+
+	for _, method := range []string{http.MethodPost, http.MethodPut} {
+		path := "/admin/subscription"
+		if method == http.MethodPut {
+			path += "/1"
+		}
+		req := httptest.NewRequest(method, path, bytes.NewReader([]byte(`{"plan":"monthly"}`)))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("anonymous %s %s: status %d, want 401", method, path, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package totp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"os"
+)
+
+// ErrNoEncryptionKey - ключ шифрования секретов не загружен.
+var ErrNoEncryptionKey = errors.New("TOTP encryption key is not configured")
+
+// EncryptionKey - 256-битный ключ шифрования секретов TOTP; задается в main.
+var EncryptionKey []byte
+
+// LoadEncryptionKeyFromEnv читает ключ из TOTP_ENCRYPTION_KEY (base64, 32 байта).
+// Переменная обязательна: ключ не выводится из секретов в исходном коде.
+// Секреты, зашифрованные прежним выводимым ключом, расшифровываются, если
+// задать TOTP_ENCRYPTION_KEY = base64(sha256("totp:" + прежний секрет JWT)).
+func LoadEncryptionKeyFromEnv() ([]byte, error) {
+	encoded := os.Getenv("TOTP_ENCRYPTION_KEY")
+	if encoded == "" {
+		return nil, errors.New("TOTP_ENCRYPTION_KEY is required")
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, errors.New("TOTP_ENCRYPTION_KEY must be 32 bytes")
+	}
+	return key, nil
+}
+
+// EncryptSecret шифрует секрет AES-256-GCM; nonce хранится перед шифротекстом.
+func EncryptSecret(secret string) (string, error) {
+	if EncryptionKey == nil {
+		return "", ErrNoEncryptionKey
+	}
+	block, err := aes.NewCipher(EncryptionKey)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(secret), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptSecret расшифровывает значение, полученное из EncryptSecret.
+func DecryptSecret(encrypted string) (string, error) {
+	if EncryptionKey == nil {
+		return "", ErrNoEncryptionKey
+	}
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(EncryptionKey)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("encrypted secret is too short")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}